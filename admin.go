@@ -0,0 +1,290 @@
+package logo
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AdminHandler returns an http.Handler which can be used to inspect and
+// change logging levels while an application is running. Paths are relative
+// to the handler, which is normally mounted using http.StripPrefix, e.g.
+//
+//   http.Handle("/logging/", http.StripPrefix("/logging", logo.AdminHandler()))
+//
+// The handler supports the following requests:
+//
+//   GET /                 the manager level, global properties and all loggers
+//   GET /level            the manager level
+//   PUT /level            sets the manager level
+//   GET /loggers/{name}   the named logger; the default logger is "/loggers/"
+//   PUT /loggers/{name}   sets the level of the named logger
+//
+// POST can be used in place of PUT. The new level is specified by the "level"
+// parameter, in the query string, a form or a JSON object. If the "ttl"
+// parameter is specified (e.g. "10m"), the change is temporary, and the
+// previous level is restored once it expires, unless the level has been
+// changed again in the meantime.
+//
+// The handler does not perform any authentication; access should be
+// restricted by the application.
+func AdminHandler() http.Handler {
+	return &adminHandler{
+		overrides: make(map[string]*override),
+	}
+}
+
+type adminHandler struct {
+	mu        sync.Mutex
+	overrides map[string]*override // keyed by request path
+}
+
+// override is a temporary level change, which is reverted when it expires.
+type override struct {
+	level   Severity
+	expires time.Time
+	timer   *time.Timer
+	restore func() // restores the level which was overridden
+}
+
+type adminStatus struct {
+	Level      string                 `json:"level"`
+	Properties map[string]interface{} `json:"properties"`
+	Loggers    []adminLogger          `json:"loggers"`
+}
+
+type adminLevel struct {
+	Level    string         `json:"level"`
+	Override *adminOverride `json:"override,omitempty"`
+}
+
+type adminLogger struct {
+	LoggerInfo
+	Override *adminOverride `json:"override,omitempty"`
+}
+
+type adminOverride struct {
+	Level   string    `json:"level"`
+	Expires time.Time `json:"expires"`
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	switch {
+	case path == "/":
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, h.status())
+	case path == "/level":
+		if !allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodPost) {
+			return
+		}
+		if r.Method != http.MethodGet {
+			s, ttl, err := levelRequest(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.setManagerLevel(path, s, ttl)
+		}
+		writeJSON(w, adminLevel{
+			Level:    levelName(manager.getLevel()),
+			Override: h.override(path),
+		})
+	case strings.HasPrefix(path, "/loggers/"):
+		if !allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodPost) {
+			return
+		}
+		manager.mu.Lock()
+		l, ok := manager.loggers[strings.TrimPrefix(path, "/loggers/")]
+		manager.mu.Unlock()
+		if !ok {
+			http.Error(w, "logger not found", http.StatusNotFound)
+			return
+		}
+		if r.Method != http.MethodGet {
+			s, ttl, err := levelRequest(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.setLoggerLevel(path, l, s, ttl)
+		}
+		writeJSON(w, h.logger(path, l.describe()))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// allowMethods reports whether the request method is one of those specified,
+// otherwise it writes an error response.
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+// levelRequest returns the level and ttl specified in the request.
+func levelRequest(r *http.Request) (Severity, time.Duration, error) {
+	var p struct {
+		Level string `json:"level"`
+		TTL   string `json:"ttl"`
+	}
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if ct == "application/json" {
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			return none, 0, fmt.Errorf("invalid request: %v", err)
+		}
+	} else {
+		p.Level, p.TTL = r.FormValue("level"), r.FormValue("ttl")
+	}
+
+	if p.Level == "" {
+		return none, 0, fmt.Errorf("level: required")
+	}
+	s, err := parseSeverity(p.Level)
+	if err != nil {
+		return none, 0, fmt.Errorf("level: %v", err)
+	}
+	var ttl time.Duration
+	if p.TTL != "" {
+		if ttl, err = time.ParseDuration(p.TTL); err != nil || ttl <= 0 {
+			return none, 0, fmt.Errorf("ttl: invalid duration %q", p.TTL)
+		}
+	}
+	return s, ttl, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(b, '\n'))
+}
+
+func (h *adminHandler) status() adminStatus {
+	props := manager.getProperties()
+	s := adminStatus{
+		Level:      levelName(manager.getLevel()),
+		Properties: make(map[string]interface{}, len(props)),
+	}
+	for k, v := range props {
+		// avoid failing the response because of a single property
+		if _, err := json.Marshal(v); err != nil {
+			v = fmt.Sprint(v)
+		}
+		s.Properties[k] = v
+	}
+	for _, l := range Loggers() {
+		s.Loggers = append(s.Loggers, h.logger("/loggers/"+l.Name, l))
+	}
+	return s
+}
+
+func (h *adminHandler) logger(path string, l LoggerInfo) adminLogger {
+	return adminLogger{
+		LoggerInfo: l,
+		Override:   h.override(path),
+	}
+}
+
+// override returns details of the override for the path, or nil if there is
+// none.
+func (h *adminHandler) override(path string) *adminOverride {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	o, ok := h.overrides[path]
+	if !ok {
+		return nil
+	}
+	return &adminOverride{
+		Level:   levelName(o.level),
+		Expires: o.expires,
+	}
+}
+
+func (h *adminHandler) setManagerLevel(path string, s Severity, ttl time.Duration) {
+	h.set(path, s, ttl,
+		func() Severity { return manager.getLevel() },
+		func() func() {
+			prev := manager.getLevel()
+			return func() { atomic.StoreInt32(&manager.level, int32(prev)) }
+		},
+		func() { atomic.StoreInt32(&manager.level, int32(s)) },
+	)
+}
+
+func (h *adminHandler) setLoggerLevel(path string, l *Logger, s Severity, ttl time.Duration) {
+	h.set(path, s, ttl,
+		func() Severity { return l.load().level },
+		func() func() {
+			prev := *l.load()
+			return func() {
+				l.update(func(c *loggerConfig) {
+					c.level = prev.level
+					c.levelSet = prev.levelSet
+				})
+			}
+		},
+		func() { l.setLevel(s) },
+	)
+}
+
+// set applies a level change for the path. If ttl is not zero, the change is
+// temporary: save is called to record the current level, and the function it
+// returns is called to restore it once ttl has elapsed, provided that current
+// still returns the level s. Any earlier override for the path is cancelled,
+// but the level it overrode is restored when the new override expires.
+func (h *adminHandler) set(path string, s Severity, ttl time.Duration, current func() Severity, save func() func(), apply func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	prev, ok := h.overrides[path]
+	if ok {
+		prev.timer.Stop()
+		delete(h.overrides, path)
+	}
+	if ttl == 0 {
+		apply()
+		return
+	}
+
+	o := &override{
+		level:   s,
+		expires: timenow().Add(ttl),
+	}
+	if ok {
+		o.restore = prev.restore
+	} else {
+		o.restore = save()
+	}
+	o.timer = time.AfterFunc(ttl, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.overrides[path] != o {
+			return
+		}
+		delete(h.overrides, path)
+		if current() == o.level {
+			o.restore()
+		}
+	})
+	h.overrides[path] = o
+	apply()
+}
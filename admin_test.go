@@ -0,0 +1,136 @@
+package logo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func adminRequest(t *testing.T, h http.Handler, method, target, contentType, body string) (int, string) {
+	t.Helper()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	b, _ := ioutil.ReadAll(w.Result().Body)
+	return w.Code, string(b)
+}
+
+func TestAdminHandlerStatus(t *testing.T) {
+	defer reset()
+	New("db", "warn")
+	SetManagerLevel("info")
+	SetGlobalProperty("cluster", "c1")
+	SetGlobalProperty("callback", func() {})
+
+	code, body := adminRequest(t, AdminHandler(), "GET", "/", "", "")
+	if code != http.StatusOK {
+		t.Fatalf("Status code got %d, want %d", code, http.StatusOK)
+	}
+	var got adminStatus
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+
+	var tests = []struct {
+		property string
+		got      interface{}
+		want     interface{}
+	}{
+		{"level", got.Level, "INFO"},
+		{"cluster property", got.Properties["cluster"], "c1"},
+		{"callback property", strings.HasPrefix(got.Properties["callback"].(string), "0x"), true},
+		{"logger count", len(got.Loggers), 2},
+		{"logger name", got.Loggers[1].Name, "db"},
+		{"logger level", got.Loggers[1].Level, "WARN"},
+		{"logger effective level", got.Loggers[0].EffectiveLevel, "INFO"},
+		{"logger appenders", strings.Join(got.Loggers[1].Appenders, ","), "console"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s got %v, want %v", test.property, test.got, test.want)
+		}
+	}
+}
+
+func TestAdminHandlerSetsLevels(t *testing.T) {
+	defer reset()
+	l := New("db", "warn")
+	h := AdminHandler()
+
+	var tests = []struct {
+		method      string
+		target      string
+		contentType string
+		body        string
+		code        int
+		want        string
+	}{
+		{"PUT", "/loggers/db?level=debug", "", "", 200, `"level": "DEBUG"`},
+		{"POST", "/loggers/db", "application/x-www-form-urlencoded", "level=error", 200, `"level": "ERROR"`},
+		{"PUT", "/loggers/db", "application/json", `{"level": "info"}`, 200, `"level": "INFO"`},
+		{"PUT", "/level?level=warn", "", "", 200, `"level": "WARN"`},
+		{"GET", "/level", "", "", 200, `"level": "WARN"`},
+		{"PUT", "/loggers/db?level=loud", "", "", 400, `level: unrecognised level "loud"`},
+		{"PUT", "/loggers/db", "", "", 400, "level: required"},
+		{"PUT", "/loggers/db?level=info&ttl=soon", "", "", 400, `ttl: invalid duration "soon"`},
+		{"PUT", "/loggers/db", "application/json", `{"level": `, 400, "invalid request"},
+		{"PUT", "/loggers/missing?level=info", "", "", 404, "logger not found"},
+		{"DELETE", "/loggers/db", "", "", 405, "method not allowed"},
+		{"GET", "/unknown", "", "", 404, "not found"},
+	}
+	for _, test := range tests {
+		code, body := adminRequest(t, h, test.method, test.target, test.contentType, test.body)
+		if code != test.code {
+			t.Errorf("%s %s status code got %d, want %d", test.method, test.target, code, test.code)
+		}
+		if !strings.Contains(body, test.want) {
+			t.Errorf("%s %s body got %q, want %q", test.method, test.target, body, test.want)
+		}
+	}
+
+	if got, want := l.Level(), "INFO"; got != want {
+		t.Errorf("Logger level got %v, want %v", got, want)
+	}
+	if got, want := ManagerLevel(), "WARN"; got != want {
+		t.Errorf("Manager level got %v, want %v", got, want)
+	}
+}
+
+func TestAdminHandlerOverrideReverts(t *testing.T) {
+	defer reset()
+	l := New("db", "warn")
+	h := AdminHandler()
+
+	adminRequest(t, h, "PUT", "/loggers/db?level=info&ttl=1h", "", "")
+	code, body := adminRequest(t, h, "PUT", "/loggers/db?level=debug&ttl=20ms", "", "")
+	if code != http.StatusOK || !strings.Contains(body, `"override"`) {
+		t.Errorf("Response got %d %q, want override", code, body)
+	}
+	if got, want := l.Level(), "DEBUG"; got != want {
+		t.Errorf("Logger level got %v, want %v", got, want)
+	}
+	// reverts to the level before the first override
+	if !waitFor(func() bool { return l.Level() == "WARN" }) {
+		t.Errorf("Logger level got %v, want %v", l.Level(), "WARN")
+	}
+	if _, body := adminRequest(t, h, "GET", "/loggers/db", "", ""); strings.Contains(body, `"override"`) {
+		t.Errorf("Override not removed, %q", body)
+	}
+
+	adminRequest(t, h, "PUT", "/level?level=error&ttl=20ms", "", "")
+	SetManagerLevel("info") // changed again, so not reverted
+	time.Sleep(50 * time.Millisecond)
+	if _, body := adminRequest(t, h, "GET", "/level", "", ""); strings.Contains(body, `"override"`) {
+		t.Errorf("Override not removed, %q", body)
+	}
+	if got, want := ManagerLevel(), "INFO"; got != want {
+		t.Errorf("Manager level got %v, want %v", got, want)
+	}
+}
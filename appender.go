@@ -3,10 +3,15 @@ package logo
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -14,6 +19,77 @@ import (
 
 var defaultFormat = "%date %severity (%file:%line) - %message%newline"
 
+// errorReporter passes appender errors to the log manager's error handlers.
+// It is embedded in the standard appenders, which are told their name when
+// added to the log manager.
+type errorReporter struct {
+	mu   sync.RWMutex
+	name string
+}
+
+func (r *errorReporter) setName(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.name = name
+}
+
+func (r *errorReporter) reportError(err error) {
+	r.mu.RLock()
+	name := r.name
+	r.mu.RUnlock()
+	handleError(name, err)
+}
+
+// layout holds the formatters and filters of an appender. It is embedded in
+// the standard appenders. Formatters and filters are replaced rather than
+// modified, so an appender can be reconfigured while logging.
+type layout struct {
+	lmu        sync.RWMutex
+	formatters []Formatter
+	filters    map[Severity]bool
+}
+
+func (l *layout) SetFormat(format string) error {
+	f, err := extract(format)
+	if err != nil {
+		return err
+	}
+	l.lmu.Lock()
+	defer l.lmu.Unlock()
+	l.formatters = f
+	return nil
+}
+
+func (l *layout) SetFilters(f ...string) {
+	filters := make(map[Severity]bool)
+	for _, n := range f {
+		s := severityFromName(n)
+		filters[s] = true
+	}
+	l.lmu.Lock()
+	defer l.lmu.Unlock()
+	l.filters = filters
+}
+
+// format writes the message to its buffer, unless it is excluded by the
+// filters. It reports whether the message should be written, together with
+// any formatting error.
+func (l *layout) format(m *LogMessage) (bool, error) {
+	l.lmu.RLock()
+	formatters, filters := l.formatters, l.filters
+	l.lmu.RUnlock()
+
+	m.Reset()
+	if !filters[m.severity] {
+		return false, nil
+	}
+	m.err = nil
+	for _, f := range formatters {
+		f.Format(m)
+	}
+	return true, m.err
+}
+
 // Appender is the interface describing a logger appender.
 // Each logger may have one or more appenders and will call Append
 // passing in a LogMessage. Append will format the message using
@@ -28,6 +104,10 @@ var defaultFormat = "%date %severity (%file:%line) - %message%newline"
 //  appender.SetFilters("debug", "warn")
 // Close is called when the log manager is closed; Appender implementations
 // must use this to flush and close any open files, connections, etc.
+// Appenders can read the details of a message using the LogMessage accessor
+// methods, e.g. Severity and Properties. The message is reused once Append
+// returns, so an Appender which processes messages later must copy any
+// details it needs.
 type Appender interface {
 	Append(m *LogMessage)
 	SetFormat(format string) error
@@ -52,57 +132,76 @@ func (a *emptyAppender) SetFilters(f ...string) {}
 // ConsoleAppender writes formatted log messages to StdErr using the default format.
 var ConsoleAppender = newConsoleAppender()
 
-func newConsoleAppender() *consoleAppender {
-	a := consoleAppender{
-		out: os.Stderr,
+// StdoutAppender writes formatted log messages to StdOut using the default
+// format. It is typically used in containers, where the log collector reads
+// StdOut, e.g.
+//
+//   logo.AddAppender("stdout", logo.StdoutAppender)
+var StdoutAppender = WriterAppender(os.Stdout)
+
+func newConsoleAppender() *ConsoleWriter {
+	return WriterAppender(os.Stderr)
+}
+
+// WriterAppender returns an appender which writes formatted log messages to
+// w, using the default format. It has the same features as ConsoleAppender,
+// including colouring (see SetColorMode), and can be used to log to any
+// writer, e.g. a bytes.Buffer or a pipe. Writes are serialized, so w does not
+// need to be safe for concurrent use, but must not be written to elsewhere
+// while the appender is in use. Close does not close w.
+func WriterAppender(w io.Writer) *ConsoleWriter {
+	a := ConsoleWriter{
+		out:     w,
+		palette: defaultPalette(),
 	}
 	a.SetFormat(defaultFormat)
 	a.SetFilters(severityName...)
 	return &a
 }
 
-type consoleAppender struct {
-	mu         sync.Mutex
-	out        io.Writer
-	formatters []Formatter
-	filters    map[severity]bool
+// ConsoleWriter is the appender used by ConsoleAppender and StdoutAppender,
+// and created by WriterAppender.
+type ConsoleWriter struct {
+	errorReporter
+	layout
+	mu      sync.Mutex
+	out     io.Writer
+	colored bool
+	palette []string // escape sequences indexed by severity
+	scratch []byte
 }
 
-func (a *consoleAppender) SetFormat(format string) error {
-	f, err := extract(format)
+func (a *ConsoleWriter) Append(m *LogMessage) {
+	ok, err := a.format(m)
 	if err != nil {
-		return err
+		a.reportError(err)
 	}
-	a.formatters = f
-	return nil
-}
-
-func (a *consoleAppender) Append(m *LogMessage) {
-	m.Reset()
-	if !a.filters[m.severity] {
+	if !ok {
 		return
 	}
-	for _, f := range a.formatters {
-		f.Format(m)
+	if _, err := a.writeMessage(m.severity, m.Bytes()); err != nil {
+		a.reportError(err)
 	}
-	a.Write(m.Bytes())
 }
 
-func (a *consoleAppender) Write(p []byte) (n int, err error) {
+// writeMessage writes p, which is a message with severity s, colouring it if
+// colouring is enabled.
+func (a *ConsoleWriter) writeMessage(s Severity, p []byte) (int, error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
+	if a.colored {
+		return a.writeColored(s, p)
+	}
 	return a.out.Write(p)
 }
 
-func (a *consoleAppender) SetFilters(f ...string) {
-	a.filters = make(map[severity]bool)
-	for _, n := range f {
-		s := severityFromName(n)
-		a.filters[s] = true
-	}
+func (a *ConsoleWriter) Write(p []byte) (n int, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.out.Write(p)
 }
 
-func (a *consoleAppender) Close() {
+func (a *ConsoleWriter) Close() {
 	// to satisfy interface
 }
 
@@ -112,7 +211,7 @@ func (a *consoleAppender) Close() {
 // MaxFileSize is the maximum size in MB for an individual log file, before the
 // appender rolls to a new file. New files can be created before an existing
 // reaches its maximum size because of the way RollingFileAppender always
-// creates new files at application start.
+// creates new files at application start (unless AppendExisting is set).
 // New files are created with a date-time.PID suffix. For example, if the
 // filename is "my.log", then log files will be named something like:
 //
@@ -123,14 +222,58 @@ func (a *consoleAppender) Close() {
 // which would produce:
 //
 //   my.20160726-091757.3160.log
+//
+// Old log files can be purged automatically by specifying a retention policy.
+// MaxBackups is the maximum number of rolled files to keep, MaxAge is the
+// maximum age of a rolled file (based on the date-time in its name) and
+// MaxTotalSize is the maximum size in MB of all log files combined, including
+// the current file. Whenever a new file is created, older files which match
+// the appender's naming pattern, but fall outside the policy, are deleted.
+// A zero value disables that part of the policy.
+//
+// Files can also be rolled on a schedule by specifying RollInterval. Schedules
+// are aligned to calendar boundaries (in UTC), so an interval of time.Hour
+// rolls on the hour and 24 * time.Hour rolls at midnight. A schedule can be
+// combined with MaxFileSize, in which case the appender rolls when either limit
+// is reached. A MaxFileSize of zero disables the size limit.
+//
+// Setting Compress causes each file to be gzipped in the background once the
+// appender has rolled to a new file. For example, my.log.20160726-091757.3160
+// would be replaced by:
+//
+//   my.log.20160726-091757.3160.gz
+//
+// Setting StableFilename causes the appender to always write to Filename
+// itself (e.g. my.log), which is convenient when tailing the log with tail -F.
+// When the appender rolls, the current file is renamed using the date-time.PID
+// suffix described above, and a new file with the original name is created.
+//
+// Setting AppendExisting causes the appender to reopen the newest existing log
+// file at start up and continue appending to it, provided it is below
+// MaxFileSize (and within the current RollInterval, if any).
 type RollingFileConfig struct {
 	Filename          string
 	MaxFileSize       int
 	PreserveExtension bool
+	MaxBackups        int
+	MaxAge            time.Duration
+	MaxTotalSize      int
+	RollInterval      time.Duration
+	Compress          bool
+	StableFilename    bool
+	AppendExisting    bool
 }
 
+// Common roll intervals for use with RollingFileConfig.
+const (
+	RollHourly = time.Hour
+	RollDaily  = 24 * time.Hour
+)
+
 type rollingFileAppender struct {
 	*bufio.Writer
+	errorReporter
+	layout
 	mu       sync.Mutex
 	filename string
 	ext      string
@@ -139,25 +282,41 @@ type rollingFileAppender struct {
 	//directory *string
 	bytes      uint64
 	max        uint64
-	formatters []Formatter
-	filters    map[severity]bool
+	current    string
+	pattern    *regexp.Regexp
+	maxBackups int
+	maxAge     time.Duration
+	maxTotal   uint64
+	interval   time.Duration
+	nextRoll   time.Time
+	compress   bool
+	stable     bool
+	reuse      bool
+	hk         sync.Mutex // serializes housekeeping
+	wg         sync.WaitGroup
+	closed     bool
+	done       chan struct{} // closed by Close to stop the flusher
+	errs       []error       // found while mu is held, reported by unlock
 }
 
 // RollingFileAppender returns a new rollingfile appender instance.
 // RollingFileAppender writes formatted log messages to the file specified in
 // config. RollingFileAppender will create a new file each time the maximum
-// filesize limit has been reached. New files are created with a date-time (and
-// PID) based suffix, but the original filename extension can be preserved if
-// required by setting the PreserveExtension config property.
+// filesize limit has been reached, or the roll interval (if any) has elapsed.
+// New files are created with a date-time (and PID) based suffix, but the
+// original filename extension can be preserved if required by setting the
+// PreserveExtension config property.
 //
-// Old files are not deleted by this appender; it is up to the consumer to handle
-// any purging.
+// Old files are not deleted by this appender unless a retention policy is
+// specified in config (see RollingFileConfig); otherwise it is up to the consumer
+// to handle any purging.
 //
-// Note that RollingFileAppender will always create a new file at application
-// start, and never opens an existing file to append to it. If an application is
-// started and stopped quickly several times, then this will result in the
-// creation of the same number of log files; even though max bytes may not have
-// been written to any of them.
+// Note that by default RollingFileAppender will always create a new file at
+// application start, and never opens an existing file to append to it. If an
+// application is started and stopped quickly several times, then this will
+// result in the creation of the same number of log files; even though max bytes
+// may not have been written to any of them. Set the AppendExisting config
+// property to continue writing to the newest existing file instead.
 // RollingFileAppender buffers messages to improve performance and reduce
 // blocking. Buffered data is written to disk every 30 seconds and when Close
 // is called.
@@ -167,14 +326,23 @@ func RollingFileAppender(config RollingFileConfig) (Appender, error) {
 
 	m := uint64(config.MaxFileSize) * 1024 * 1024 // megabytes
 	a := rollingFileAppender{
-		filename: config.Filename,
-		max:      m,
+		filename:   config.Filename,
+		max:        m,
+		maxBackups: config.MaxBackups,
+		maxAge:     config.MaxAge,
+		maxTotal:   uint64(config.MaxTotalSize) * 1024 * 1024, // megabytes
+		interval:   config.RollInterval,
+		compress:   config.Compress,
+		stable:     config.StableFilename,
+		reuse:      config.AppendExisting,
+		done:       make(chan struct{}),
 	}
 
 	if config.PreserveExtension {
 		a.ext = filepath.Ext(a.filename)
 		a.filename = strings.TrimSuffix(a.filename, a.ext)
 	}
+	a.pattern = lognamePattern(a.filename, a.ext)
 
 	a.SetFormat(defaultFormat)
 	a.SetFilters(severityName...)
@@ -182,7 +350,9 @@ func RollingFileAppender(config RollingFileConfig) (Appender, error) {
 	// 	dir := filepath.Join(os.TempDir(), filepath.Base(os.Args[0]))
 	// 	a.directory = &dir
 	// }
-	err := a.rotate()
+	a.mu.Lock()
+	err := a.open()
+	a.unlock()
 	if err != nil {
 		return nil, err
 	}
@@ -190,42 +360,32 @@ func RollingFileAppender(config RollingFileConfig) (Appender, error) {
 	return &a, nil
 }
 
-func (a *rollingFileAppender) SetFormat(format string) error {
-	f, err := extract(format)
+func (a *rollingFileAppender) Append(m *LogMessage) {
+	ok, err := a.format(m)
 	if err != nil {
-		return err
-	}
-	a.formatters = f
-	return nil
-}
-
-func (a *rollingFileAppender) SetFilters(f ...string) {
-	a.filters = make(map[severity]bool)
-	for _, n := range f {
-		s := severityFromName(n)
-		a.filters[s] = true
+		a.reportError(err)
 	}
-}
-
-func (a *rollingFileAppender) Append(m *LogMessage) {
-	m.Reset()
-	if !a.filters[m.severity] {
+	if !ok {
 		return
 	}
-	for _, f := range a.formatters {
-		f.Format(m)
+	if _, err := a.Write(m.Bytes()); err != nil && err != os.ErrClosed {
+		a.reportError(err)
 	}
-	a.Write(m.Bytes())
 }
 
+// Write writes p to the current file, rolling it first if required. It
+// returns os.ErrClosed once the appender has been closed.
 func (a *rollingFileAppender) Write(p []byte) (n int, err error) {
 	a.mu.Lock()
-	defer a.mu.Unlock()
-	if a.bytes+uint64(len(p)) >= a.max {
-		// TODO: consider what to do with any error from rotate().
-		// Just ignore and continue or exit the program?
-		// TODO: Call a LogRotateError() stub
-		a.rotate()
+	defer a.unlock()
+	if a.closed {
+		return 0, os.ErrClosed
+	}
+	if a.Writer == nil || a.due(len(p)) {
+		if err := a.rotate(); err != nil {
+			// no file to write to; rotation is retried on the next write
+			return 0, fmt.Errorf("rotate failed: %v", err)
+		}
 	}
 	n, err = a.Writer.Write(p)
 	// TODO: Keep track of number of bytes written since last flush
@@ -234,41 +394,340 @@ func (a *rollingFileAppender) Write(p []byte) (n int, err error) {
 	return
 }
 
+// deferError records err, to be reported by unlock. It must be called with
+// a.mu held.
+func (a *rollingFileAppender) deferError(err error) {
+	a.errs = append(a.errs, err)
+}
+
+// unlock releases a.mu, then reports any deferred errors. Errors are not
+// reported while a.mu is held, as an error handler which logs to this
+// appender would deadlock.
+func (a *rollingFileAppender) unlock() {
+	errs := a.errs
+	a.errs = nil
+	a.mu.Unlock()
+	for _, err := range errs {
+		a.reportError(err)
+	}
+}
+
+// schedule sets the time of the next roll, if a roll interval is specified.
+func (a *rollingFileAppender) schedule() {
+	if a.interval > 0 {
+		a.nextRoll = timenow().Truncate(a.interval).Add(a.interval)
+	}
+}
+
+// due reports whether the current file should be rolled before writing
+// another n bytes.
+func (a *rollingFileAppender) due(n int) bool {
+	if a.max > 0 && a.bytes+uint64(n) >= a.max {
+		return true
+	}
+	return a.interval > 0 && !timenow().Before(a.nextRoll)
+}
+
 const flushInterval = 30 * time.Second
 
+// flusher flushes the buffer to disk every flushInterval, until the appender
+// is closed.
 func (a *rollingFileAppender) flusher() {
-	for _ = range time.NewTicker(flushInterval).C {
+	t := time.NewTicker(flushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-t.C:
+		}
 		a.mu.Lock()
 		if a.Writer != nil {
-			a.Flush()
-			a.file.Sync()
+			if err := a.Flush(); err != nil {
+				a.deferError(fmt.Errorf("flush failed: %v", err))
+			} else if err := a.file.Sync(); err != nil {
+				a.deferError(fmt.Errorf("sync failed: %v", err))
+			}
 		}
-		a.mu.Unlock()
+		a.unlock()
 	}
 }
 
 const bufferSize = 256 * 1024
 
+// open opens the initial log file; reopening the newest existing file if
+// required, otherwise creating a new one.
+func (a *rollingFileAppender) open() error {
+	if a.reuse {
+		ok, err := a.reopen()
+		if err != nil || ok {
+			return err
+		}
+	}
+	return a.rotate()
+}
+
+// reopen opens the newest existing log file for appending, provided it has not
+// reached its size limit and belongs to the current roll interval. It reports
+// whether a file was opened.
+func (a *rollingFileAppender) reopen() (bool, error) {
+	name := a.filename + a.ext
+	if !a.stable {
+		files, err := a.rolledFiles("")
+		if err != nil {
+			return false, err
+		}
+		if len(files) == 0 || strings.HasSuffix(files[0].path, ".gz") {
+			return false, nil
+		}
+		name = files[0].path
+	}
+
+	fi, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	size := uint64(fi.Size())
+	if a.max > 0 && size >= a.max {
+		return false, nil
+	}
+	if a.interval > 0 && !fi.ModTime().Truncate(a.interval).Equal(timenow().Truncate(a.interval)) {
+		return false, nil
+	}
+
+	a.file, err = os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return false, err
+	}
+	a.current = name
+	a.bytes = size
+	a.schedule()
+	a.Writer = bufio.NewWriterSize(a.file, bufferSize)
+	if err := a.purge(name, size); err != nil {
+		a.deferError(err)
+	}
+	return true, nil
+}
+
 func (a *rollingFileAppender) rotate() error {
+	old := a.current
 	if a.file != nil {
-		a.Close()
+		a.closeFile()
 	}
 	a.bytes = 0
-	name := logname(a.filename, a.ext)
+	// names only have a resolution of one second, so avoid replacing a file
+	// rolled earlier in the same second
+	name := unusedName(logname(a.filename, a.ext), a.ext)
+	if a.stable {
+		// roll the current file (which may be left from a previous run)
+		// and recreate it
+		current := a.filename + a.ext
+		old = ""
+		if _, err := os.Stat(current); err == nil {
+			if err := os.Rename(current, name); err != nil {
+				return err
+			}
+			old = name
+		}
+		name = current
+	}
 	var err error
 	a.file, err = os.Create(name)
 	if err != nil {
 		return err
 	}
+	a.current = name
+	a.schedule()
 	//a.Writer = bufio.NewWriter(a.file)	// default size is 4096
 	a.Writer = bufio.NewWriterSize(a.file, bufferSize)
 	//n, err := a.file.WriteString("New log created!\n")
 	//a.bytes = uint64(n)
+
+	a.housekeep(old, name)
 	return nil
 }
 
+// housekeep compresses the previous file (if required) and purges any files
+// outside the retention policy. Compression is performed in the background,
+// so it never blocks the Write path; purging follows compression so that the
+// compressed file is accounted for.
+func (a *rollingFileAppender) housekeep(old, current string) {
+	if !a.compress || old == "" {
+		if err := a.purge(current, 0); err != nil {
+			a.deferError(err)
+		}
+		return
+	}
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.hk.Lock()
+		defer a.hk.Unlock()
+		if err := compressFile(old); err != nil {
+			a.reportError(err)
+		}
+		if err := a.purge(current, 0); err != nil {
+			a.reportError(err)
+		}
+	}()
+}
+
+// compressFile gzips the named file, replacing it with name.gz.
+func compressFile(name string) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("compress failed: %v", err)
+	}
+	defer src.Close()
+
+	tmp := name + ".gz.tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("compress failed: %v", err)
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(tmp)
+			err = fmt.Errorf("compress failed: %v", err)
+		}
+	}()
+
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(name)
+	if _, err = io.Copy(zw, src); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, name+".gz"); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Remove(name)
+}
+
+// purge deletes any rolled files which fall outside the retention policy.
+// Files are matched using the same prefix and suffix pattern as logname, so
+// unrelated files in the same directory are never touched.
+// The current file is never deleted, but its size counts towards the total.
+func (a *rollingFileAppender) purge(current string, size uint64) error {
+	if a.maxBackups <= 0 && a.maxAge <= 0 && a.maxTotal == 0 {
+		return nil
+	}
+	files, err := a.rolledFiles(current)
+	if err != nil {
+		return err
+	}
+
+	now := timenow()
+	total := size
+	var errs []string
+	for i, f := range files {
+		total += uint64(f.size)
+		if (a.maxBackups > 0 && i >= a.maxBackups) ||
+			(a.maxAge > 0 && now.Sub(f.timestamp) > a.maxAge) ||
+			(a.maxTotal > 0 && total > a.maxTotal) {
+			if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("purge failed: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+type rolledFile struct {
+	path      string
+	timestamp time.Time
+	seq       int // numeric suffix added by unusedName, or zero
+	size      int64
+}
+
+// rolledFiles returns the rolled files belonging to the appender (excluding
+// the current file), newest first.
+func (a *rollingFileAppender) rolledFiles(current string) ([]rolledFile, error) {
+	dir := filepath.Dir(a.filename)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []rolledFile
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if path == filepath.Clean(current) {
+			continue
+		}
+		sm := a.pattern.FindStringSubmatch(e.Name())
+		if sm == nil {
+			continue
+		}
+		ts, err := time.Parse(lognameTimeLayout, sm[1])
+		if err != nil {
+			continue
+		}
+		seq, _ := strconv.Atoi(sm[2])
+		files = append(files, rolledFile{path: path, timestamp: ts, seq: seq, size: e.Size()})
+	}
+	sort.Sort(byNewest(files))
+	return files, nil
+}
+
+type byNewest []rolledFile
+
+func (s byNewest) Len() int      { return len(s) }
+func (s byNewest) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byNewest) Less(i, j int) bool {
+	if s[i].timestamp.Equal(s[j].timestamp) {
+		if s[i].seq != s[j].seq {
+			return s[i].seq > s[j].seq
+		}
+		return s[i].path > s[j].path
+	}
+	return s[i].timestamp.After(s[j].timestamp)
+}
+
+const lognameTimeLayout = "20060102-150405"
+
+// lognamePattern returns a regular expression matching the names generated
+// by logname for the given filename and extension, including any numeric
+// suffix added by unusedName and any compressed files. The first submatch is
+// the date-time part of the name, and the second is the numeric suffix.
+func lognamePattern(fname string, ext string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(filepath.Base(fname)) +
+		`\.(\d{8}-\d{6})\.\d+(?:\.(\d+))?` + regexp.QuoteMeta(ext) + `(\.gz)?$`)
+}
+
 var pid = os.Getpid()
 
+// unusedName returns name if neither it nor its compressed form exists,
+// otherwise it inserts a numeric suffix before ext, e.g. test.log becomes
+// test.1.log, test.2.log and so on.
+func unusedName(name string, ext string) string {
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; fileExists(name) || fileExists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s.%d%s", base, i, ext)
+	}
+	return name
+}
+
+func fileExists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
 func logname(fname string, ext string) string {
 	t := timenow().UTC()
 	return fmt.Sprintf("%s.%04d%02d%02d-%02d%02d%02d.%d%s",
@@ -283,10 +742,30 @@ func logname(fname string, ext string) string {
 		ext)
 }
 
+// Close flushes and closes the current file. Messages logged after Close are
+// dropped.
 func (a *rollingFileAppender) Close() {
+	a.mu.Lock()
+	if !a.closed && a.done != nil {
+		close(a.done)
+	}
+	a.closed = true
+	a.closeFile()
+	a.unlock()
+	// wait for any background compression to complete
+	a.wg.Wait()
+}
+
+func (a *rollingFileAppender) closeFile() {
 	if a.Writer != nil {
-		a.Flush()
-		a.file.Close()
+		if err := a.Flush(); err != nil {
+			a.deferError(fmt.Errorf("flush failed: %v", err))
+		}
+		if a.file != nil {
+			if err := a.file.Close(); err != nil {
+				a.deferError(fmt.Errorf("close failed: %v", err))
+			}
+		}
 		a.Writer = nil
 		a.file = nil
 	}
@@ -300,8 +779,8 @@ var TestAppender = newTestAppender()
 func newTestAppender() *testAppender {
 	b := new(bytes.Buffer)
 	a := testAppender{
-		buf:             b,
-		consoleAppender: &consoleAppender{out: b},
+		buf:           b,
+		ConsoleWriter: WriterAppender(b),
 	}
 	a.SetFormat(defaultFormat)
 	a.SetFilters(severityName...)
@@ -309,7 +788,7 @@ func newTestAppender() *testAppender {
 }
 
 type testAppender struct {
-	*consoleAppender
+	*ConsoleWriter
 	logMessages []*LogMessage
 	Closed      bool
 	Format      string
@@ -337,23 +816,23 @@ func (a *testAppender) Append(m *LogMessage) {
 
 	a.logMessages = append(a.logMessages, n)
 	a.buf.Reset()
-	a.consoleAppender.Append(m)
+	a.ConsoleWriter.Append(m)
 	s := string(a.buf.Bytes())
 	a.Messages = append(a.Messages, s)
 }
 
 func (a *testAppender) Close() {
-	a.consoleAppender.Close()
+	a.ConsoleWriter.Close()
 	a.Closed = true
 }
 
 func (a *testAppender) SetFormat(format string) error {
 	a.Format = format
-	return a.consoleAppender.SetFormat(format)
+	return a.ConsoleWriter.SetFormat(format)
 }
 
 func (a *testAppender) SetFilters(f ...string) {
-	a.consoleAppender.SetFilters(f...)
+	a.ConsoleWriter.SetFilters(f...)
 }
 
 func (a *testAppender) Reset() {
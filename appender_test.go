@@ -3,6 +3,12 @@ package logo
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -88,7 +94,7 @@ func TestConsoleAppenderWithSingleFilter(t *testing.T) {
 	appender.SetFormat("%s-%m")
 
 	m := testMessage()
-	m.severity = info
+	m.severity = InfoLevel
 	appender.Append(m)
 
 	got := len(b.Bytes())
@@ -107,7 +113,7 @@ func TestConsoleAppenderWithMultipleSingleFilters(t *testing.T) {
 	appender.SetFormat("%s-%m")
 
 	m := testMessage()
-	m.severity = info
+	m.severity = InfoLevel
 	appender.Append(m)
 
 	got := string(b.Bytes())
@@ -385,3 +391,524 @@ func TestTestAppenderMessagesWhenMultiple(t *testing.T) {
 		t.Errorf("DefaultFormat got %q, want %q", got, want)
 	}
 }
+
+func createRolledFiles(t *testing.T, dir string, names ...string) {
+	for _, n := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, n), []byte("0123456789"), 0644); err != nil {
+			t.Fatalf("unable to create test file: %v", err)
+		}
+	}
+}
+
+func remainingFiles(t *testing.T, dir string) string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unable to read test directory: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func TestRollingFileAppenderPurgeRetention(t *testing.T) {
+	timenow = func() time.Time {
+		t, _ := time.Parse("2006-01-02T15:04:05", "2016-11-19T15:14:15")
+		return t
+	}
+	defer reset()
+
+	var tests = []struct {
+		property   string
+		maxBackups int
+		maxAge     time.Duration
+		maxTotal   uint64
+		want       string
+	}{
+		{"no policy", 0, 0, 0, "other.log.20161119-120000.1,test.log.20161117-120000.1,test.log.20161118-120000.1,test.log.20161119-120000.1,test.log.20161119-151415.2"},
+		{"max backups", 1, 0, 0, "other.log.20161119-120000.1,test.log.20161119-120000.1,test.log.20161119-151415.2"},
+		{"max age", 0, 36 * time.Hour, 0, "other.log.20161119-120000.1,test.log.20161118-120000.1,test.log.20161119-120000.1,test.log.20161119-151415.2"},
+		{"max total", 0, 0, 25, "other.log.20161119-120000.1,test.log.20161118-120000.1,test.log.20161119-120000.1,test.log.20161119-151415.2"},
+		{"combined", 2, 12 * time.Hour, 0, "other.log.20161119-120000.1,test.log.20161119-120000.1,test.log.20161119-151415.2"},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		createRolledFiles(t, dir,
+			"test.log.20161117-120000.1",
+			"test.log.20161118-120000.1",
+			"test.log.20161119-120000.1",
+			"test.log.20161119-151415.2",
+			"other.log.20161119-120000.1",
+		)
+		filename := filepath.Join(dir, "test.log")
+		appender := &rollingFileAppender{
+			filename:   filename,
+			current:    filepath.Join(dir, "test.log.20161119-151415.2"),
+			pattern:    lognamePattern(filename, ""),
+			maxBackups: test.maxBackups,
+			maxAge:     test.maxAge,
+			maxTotal:   test.maxTotal,
+		}
+		if err := appender.purge(appender.current, 0); err != nil {
+			t.Errorf("%s purge error: %v", test.property, err)
+		}
+		got := remainingFiles(t, dir)
+		if got != test.want {
+			t.Errorf("%s got %q, want %q", test.property, got, test.want)
+		}
+	}
+}
+
+func TestRollingFileAppenderPurgeMatchesPreservedExtension(t *testing.T) {
+	want := "test.20161119-120000.1.log,test.log,test.log.20161118-120000.1"
+	dir := t.TempDir()
+	createRolledFiles(t, dir,
+		"test.20161118-120000.1.log",
+		"test.20161119-120000.1.log",
+		"test.log.20161118-120000.1",
+		"test.log",
+	)
+	filename := filepath.Join(dir, "test")
+	appender := &rollingFileAppender{
+		filename:   filename,
+		ext:        ".log",
+		pattern:    lognamePattern(filename, ".log"),
+		maxBackups: 1,
+	}
+	appender.purge(appender.current, 0)
+	got := remainingFiles(t, dir)
+	if got != want {
+		t.Errorf("Remaining files got %q, want %q", got, want)
+	}
+}
+
+func TestRollingFileAppenderPurgeOrdersSameSecondFilesBySuffix(t *testing.T) {
+	for _, ext := range []string{"", ".log"} {
+		dir := t.TempDir()
+		names := []string{"svc.20160409-180328.1" + ext}
+		for i := 1; i <= 11; i++ {
+			names = append(names, fmt.Sprintf("svc.20160409-180328.1.%d%s", i, ext))
+		}
+		createRolledFiles(t, dir, names...)
+		filename := filepath.Join(dir, "svc")
+		appender := &rollingFileAppender{
+			filename:   filename,
+			ext:        ext,
+			pattern:    lognamePattern(filename, ext),
+			maxBackups: 3,
+		}
+
+		files, err := appender.rolledFiles("")
+		if err != nil {
+			t.Fatalf("rolledFiles error: %v", err)
+		}
+		if got, want := filepath.Base(files[0].path), "svc.20160409-180328.1.11"+ext; got != want {
+			t.Errorf("%q newest file got %q, want %q", ext, got, want)
+		}
+		appender.purge("", 0)
+		want := fmt.Sprintf("svc.20160409-180328.1.10%[1]s,svc.20160409-180328.1.11%[1]s,svc.20160409-180328.1.9%[1]s", ext)
+		if got := remainingFiles(t, dir); got != want {
+			t.Errorf("%q remaining files got %q, want %q", ext, got, want)
+		}
+	}
+}
+
+func TestRollingFileAppenderRollsWhenIntervalElapses(t *testing.T) {
+	now, _ := time.Parse("2006-01-02T15:04:05", "2016-11-19T15:14:15")
+	timenow = func() time.Time { return now }
+	defer reset()
+
+	dir := t.TempDir()
+	a, err := RollingFileAppender(RollingFileConfig{
+		Filename:     filepath.Join(dir, "test.log"),
+		RollInterval: RollHourly,
+	})
+	if err != nil {
+		t.Fatalf("RollingFileAppender error: %v", err)
+	}
+	defer a.Close()
+	appender := a.(*rollingFileAppender)
+
+	var tests = []struct {
+		now  string
+		want string
+	}{
+		{"2016-11-19T15:59:59", "test.log.20161119-151415."},
+		{"2016-11-19T16:00:00", "test.log.20161119-160000."},
+		{"2016-11-19T16:45:10", "test.log.20161119-160000."},
+		{"2016-11-19T17:02:00", "test.log.20161119-170200."},
+	}
+
+	for _, test := range tests {
+		now, _ = time.Parse("2006-01-02T15:04:05", test.now)
+		appender.Append(testMessage())
+		got := strings.TrimSuffix(filepath.Base(appender.current), strconv.Itoa(pid))
+		if got != test.want {
+			t.Errorf("%s current file got %q, want %q", test.now, got, test.want)
+		}
+	}
+}
+
+func TestRollingFileAppenderDue(t *testing.T) {
+	now, _ := time.Parse("2006-01-02T15:04:05", "2016-11-19T15:14:15")
+	timenow = func() time.Time { return now }
+	defer reset()
+
+	next, _ := time.Parse("2006-01-02T15:04:05", "2016-11-20T00:00:00")
+
+	var tests = []struct {
+		property string
+		max      uint64
+		interval time.Duration
+		bytes    uint64
+		want     bool
+	}{
+		{"no limits", 0, 0, 5000, false},
+		{"below size", 1024, 0, 1000, false},
+		{"size reached", 1024, 0, 1020, true},
+		{"interval not elapsed", 0, RollDaily, 5000, false},
+		{"size reached before interval", 1024, RollDaily, 1020, true},
+	}
+
+	for _, test := range tests {
+		appender := &rollingFileAppender{
+			max:      test.max,
+			interval: test.interval,
+			bytes:    test.bytes,
+			nextRoll: next,
+		}
+		got := appender.due(10)
+		if got != test.want {
+			t.Errorf("%s got %t, want %t", test.property, got, test.want)
+		}
+	}
+
+	now = next
+	appender := &rollingFileAppender{interval: RollDaily, nextRoll: next}
+	if !appender.due(10) {
+		t.Errorf("interval elapsed got false, want true")
+	}
+}
+
+func TestRollingFileAppenderCompressesRolledFile(t *testing.T) {
+	want := "2016-04-09 18:03:28.342017 INFO (sample.go:456) - Test 34 (56)\n"
+	now, _ := time.Parse("2006-01-02T15:04:05", "2016-11-19T15:14:15")
+	timenow = func() time.Time { return now }
+	defer reset()
+
+	dir := t.TempDir()
+	a, err := RollingFileAppender(RollingFileConfig{
+		Filename:          filepath.Join(dir, "test.log"),
+		PreserveExtension: true,
+		RollInterval:      RollHourly,
+		Compress:          true,
+	})
+	if err != nil {
+		t.Fatalf("RollingFileAppender error: %v", err)
+	}
+	a.Append(testMessage())
+	now = now.Add(time.Hour)
+	a.Append(testMessage())
+	a.Close()
+
+	name := filepath.Join(dir, "test.20161119-151415."+strconv.Itoa(pid)+".log")
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("Uncompressed file still exists")
+	}
+	f, err := os.Open(name + ".gz")
+	if err != nil {
+		t.Fatalf("Compressed file error: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Compressed file error: %v", err)
+	}
+	b, _ := ioutil.ReadAll(zr)
+	got := string(b)
+	if got != want {
+		t.Errorf("Compressed content got %q, want %q", got, want)
+	}
+}
+
+func TestRollingFileAppenderReportsCompressionError(t *testing.T) {
+	want := "logo: compress failed: open "
+	var b bytes.Buffer
+	errorOutput = &b
+	defer func() { errorOutput = os.Stderr }()
+
+	appender := &rollingFileAppender{compress: true}
+	appender.housekeep(filepath.Join(t.TempDir(), "missing.log"), "")
+	appender.wg.Wait()
+
+	got := b.String()
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("Error output got %q, want prefix %q", got, want)
+	}
+}
+
+func TestRollingFileAppenderStableFilenameRollsByRenaming(t *testing.T) {
+	now, _ := time.Parse("2006-01-02T15:04:05", "2016-11-19T15:14:15")
+	timenow = func() time.Time { return now }
+	defer reset()
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.log")
+	createRolledFiles(t, dir, "test.log") // left from a previous run
+
+	a, err := RollingFileAppender(RollingFileConfig{
+		Filename:       filename,
+		RollInterval:   RollHourly,
+		StableFilename: true,
+	})
+	if err != nil {
+		t.Fatalf("RollingFileAppender error: %v", err)
+	}
+	a.Append(testMessage())
+	now = now.Add(time.Hour)
+	a.Append(testMessage())
+	a.Close()
+
+	pidStr := strconv.Itoa(pid)
+	want := "test.log,test.log.20161119-151415." + pidStr + ",test.log.20161119-161415." + pidStr
+	got := remainingFiles(t, dir)
+	if got != want {
+		t.Errorf("Files got %q, want %q", got, want)
+	}
+
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "test.log.20161119-151415."+pidStr))
+	if string(b) != "0123456789" {
+		t.Errorf("Previous file content got %q, want %q", b, "0123456789")
+	}
+}
+
+func TestRollingFileAppenderStableFilenameRollsTwiceInOneSecond(t *testing.T) {
+	now, _ := time.Parse("2006-01-02T15:04:05", "2016-11-19T15:14:15")
+	timenow = func() time.Time { return now }
+	defer reset()
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.log")
+	appender, err := RollingFileAppender(RollingFileConfig{
+		Filename:       filename,
+		StableFilename: true,
+	})
+	if err != nil {
+		t.Fatalf("RollingFileAppender error: %v", err)
+	}
+	a := appender.(*rollingFileAppender)
+	roll := func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if err := a.rotate(); err != nil {
+			t.Fatalf("rotate error: %v", err)
+		}
+	}
+	a.Write([]byte("first"))
+	roll()
+	a.Write([]byte("second"))
+	roll()
+	a.Write([]byte("third"))
+	a.Close()
+
+	rolled := "test.log.20161119-151415." + strconv.Itoa(pid)
+	want := "test.log," + rolled + "," + rolled + ".1"
+	if got := remainingFiles(t, dir); got != want {
+		t.Errorf("Files got %q, want %q", got, want)
+	}
+	for name, want := range map[string]string{rolled: "first", rolled + ".1": "second", "test.log": "third"} {
+		b, _ := ioutil.ReadFile(filepath.Join(dir, name))
+		if string(b) != want {
+			t.Errorf("%s content got %q, want %q", name, b, want)
+		}
+	}
+}
+
+func TestRollingFileAppenderAppendExisting(t *testing.T) {
+	timenow = func() time.Time {
+		t, _ := time.Parse("2006-01-02T15:04:05", "2016-11-19T15:14:15")
+		return t
+	}
+	defer reset()
+
+	var tests = []struct {
+		property string
+		stable   bool
+		max      int
+		existing []string
+		want     string
+	}{
+		{"stable", true, 1, []string{"test.log"}, "test.log"},
+		{"newest rolled file", false, 1, []string{"test.log.20161118-120000.1", "test.log.20161119-120000.1"}, "test.log.20161119-120000.1"},
+		{"newest is compressed", false, 1, []string{"test.log.20161118-120000.1", "test.log.20161119-120000.1.gz"}, "test.log.20161119-151415." + strconv.Itoa(pid)},
+		{"no size limit", false, 0, []string{"test.log.20161119-120000.1"}, "test.log.20161119-120000.1"},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		createRolledFiles(t, dir, test.existing...)
+		a, err := RollingFileAppender(RollingFileConfig{
+			Filename:       filepath.Join(dir, "test.log"),
+			MaxFileSize:    test.max,
+			StableFilename: test.stable,
+			AppendExisting: true,
+		})
+		if err != nil {
+			t.Fatalf("%s RollingFileAppender error: %v", test.property, err)
+		}
+		appender := a.(*rollingFileAppender)
+		got := filepath.Base(appender.current)
+		if got != test.want {
+			t.Errorf("%s current file got %q, want %q", test.property, got, test.want)
+		}
+		if len(test.existing) > 0 && got == test.existing[len(test.existing)-1] && appender.bytes != 10 {
+			t.Errorf("%s bytes got %d, want 10", test.property, appender.bytes)
+		}
+		a.Close()
+	}
+}
+
+func TestRollingFileAppenderAppendExistingAppendsToFile(t *testing.T) {
+	want := "0123456789INFO-Test 34 (56)\n"
+
+	dir := t.TempDir()
+	createRolledFiles(t, dir, "test.log")
+	a, err := RollingFileAppender(RollingFileConfig{
+		Filename:       filepath.Join(dir, "test.log"),
+		MaxFileSize:    1,
+		StableFilename: true,
+		AppendExisting: true,
+	})
+	if err != nil {
+		t.Fatalf("RollingFileAppender error: %v", err)
+	}
+	a.SetFormat("%s-%m%n")
+	a.Append(testMessage())
+	a.Close()
+
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "test.log"))
+	got := string(b)
+	if got != want {
+		t.Errorf("File content got %q, want %q", got, want)
+	}
+}
+
+func TestRollingFileAppenderAppendExistingIgnoresFileFromPreviousInterval(t *testing.T) {
+	timenow = func() time.Time {
+		t, _ := time.Parse("2006-01-02T15:04:05", "2016-11-19T15:14:15")
+		return t
+	}
+	defer reset()
+
+	dir := t.TempDir()
+	createRolledFiles(t, dir, "test.log")
+	modified, _ := time.Parse("2006-01-02T15:04:05", "2016-11-18T23:59:00")
+	os.Chtimes(filepath.Join(dir, "test.log"), modified, modified)
+
+	a, err := RollingFileAppender(RollingFileConfig{
+		Filename:       filepath.Join(dir, "test.log"),
+		RollInterval:   RollDaily,
+		StableFilename: true,
+		AppendExisting: true,
+	})
+	if err != nil {
+		t.Fatalf("RollingFileAppender error: %v", err)
+	}
+	a.Close()
+
+	want := "test.log,test.log.20161119-151415." + strconv.Itoa(pid)
+	got := remainingFiles(t, dir)
+	if got != want {
+		t.Errorf("Files got %q, want %q", got, want)
+	}
+}
+
+func TestWriterAppender(t *testing.T) {
+	var b bytes.Buffer
+	appender := WriterAppender(&b)
+	appender.SetFilters("warn")
+	appender.SetFormat("%s-%m%n")
+
+	m := testMessage()
+	appender.Append(m)
+	m.severity = WarnLevel
+	appender.Append(m)
+
+	want := "WARN-Test 34 (56)\n"
+	if got := b.String(); got != want {
+		t.Errorf("Message got %q, want %q", got, want)
+	}
+}
+
+func TestStdoutAppenderWritesToStdout(t *testing.T) {
+	if got, want := StdoutAppender.out, io.Writer(os.Stdout); got != want {
+		t.Errorf("Output got %v, want os.Stdout", got)
+	}
+	a, err := buildAppender("out", AppenderConfig{Type: "stdout", Options: []byte(`{"color": "always"}`)})
+	if err != nil {
+		t.Fatalf("Config error: %v", err)
+	}
+	if c := a.(*ConsoleWriter); c.out != io.Writer(os.Stdout) || !c.colored {
+		t.Errorf("Configured appender got %v colored %v, want os.Stdout colored", c.out, c.colored)
+	}
+}
+
+func TestRollingFileAppenderDropsMessagesAfterClose(t *testing.T) {
+	defer reset()
+	var r errorRecorder
+	SetErrorHandler(r.handle)
+
+	dir := t.TempDir()
+	a, err := RollingFileAppender(RollingFileConfig{Filename: filepath.Join(dir, "test.log")})
+	if err != nil {
+		t.Fatalf("RollingFileAppender error: %v", err)
+	}
+	a.Close()
+	before := remainingFiles(t, dir)
+
+	a.Append(testMessage())
+	if _, err := a.(*rollingFileAppender).Write([]byte("late")); err != os.ErrClosed {
+		t.Errorf("Write error got %v, want %v", err, os.ErrClosed)
+	}
+	if got := remainingFiles(t, dir); got != before {
+		t.Errorf("Files got %q, want %q", got, before)
+	}
+	if len(r.errs) != 0 {
+		t.Errorf("Errors got %v, want none", r.errs)
+	}
+}
+
+func TestRollingFileAppenderErrorHandlerCanLog(t *testing.T) {
+	defer reset()
+	dir := t.TempDir()
+	a, err := RollingFileAppender(RollingFileConfig{Filename: filepath.Join(dir, "test.log")})
+	if err != nil {
+		t.Fatalf("RollingFileAppender error: %v", err)
+	}
+	AddAppender("file", a)
+	l := New("Test", "debug")
+	l.SetAppenders("file")
+	var handled int
+	SetErrorHandler(func(appender string, err error) {
+		handled++
+		l.Errorf("appender %s failed: %v", appender, err)
+	})
+
+	l.Info("buffered")
+	a.(*rollingFileAppender).file.Close() // cause the flush to fail
+	closed := make(chan struct{})
+	go func() {
+		a.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Close deadlocked when the error handler logged")
+	}
+	if handled == 0 {
+		t.Errorf("Error handler not called")
+	}
+}
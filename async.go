@@ -0,0 +1,168 @@
+package logo
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy determines the behaviour of an asynchronous appender when
+// its queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the logging call until there is space in the queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the message being logged.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest queued message to make room.
+	OverflowDropOldest
+)
+
+var overflowNames = []string{"block", "drop-newest", "drop-oldest"}
+
+func (p OverflowPolicy) String() string {
+	if p < 0 || int(p) >= len(overflowNames) {
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+	return overflowNames[p]
+}
+
+// UnmarshalText sets the policy from its name; one of "block", "drop-newest"
+// or "drop-oldest". It enables policies to be specified in configuration files.
+func (p *OverflowPolicy) UnmarshalText(text []byte) error {
+	for i, n := range overflowNames {
+		if strings.EqualFold(n, string(text)) {
+			*p = OverflowPolicy(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unrecognised overflow policy %q", text)
+}
+
+// AsyncConfig holds key parameters for configuring an AsyncAppender.
+// QueueSize is the maximum number of messages waiting to be delivered to the
+// wrapped appender; the default is 1000. Overflow specifies what happens when
+// the queue is full; the default is OverflowBlock.
+type AsyncConfig struct {
+	QueueSize int            `json:"queueSize,omitempty"`
+	Overflow  OverflowPolicy `json:"overflow,omitempty"`
+}
+
+const defaultQueueSize = 1000
+
+// AsyncAppender returns a new asynchronous appender which wraps the appender a.
+// Logging calls copy each message onto a bounded queue and return immediately
+// (unless the queue is full and the overflow policy is OverflowBlock); messages
+// are delivered to a on a background goroutine, so a slow appender does not
+// stall the caller.
+//
+// Note that message arguments are formatted when the message is delivered, so
+// they should not be modified after the logging call.
+//
+// Close waits for all queued messages to be delivered before closing a.
+// Messages logged after Close are dropped.
+func AsyncAppender(a Appender, config AsyncConfig) *AsyncWriter {
+	size := config.QueueSize
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	as := AsyncWriter{
+		Appender: a,
+		queue:    make(chan *LogMessage, size),
+		overflow: config.Overflow,
+		done:     make(chan struct{}),
+	}
+	go as.run()
+	return &as
+}
+
+// AsyncWriter is an appender which delivers messages to a wrapped appender on
+// a background goroutine. It is created by AsyncAppender.
+type AsyncWriter struct {
+	Appender
+	dropped   uint64 // accessed atomically
+	queue     chan *LogMessage
+	overflow  OverflowPolicy
+	mu        sync.RWMutex
+	closed    bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Append queues m for delivery to the wrapped appender, as determined by the
+// overflow policy.
+func (a *AsyncWriter) Append(m *LogMessage) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		atomic.AddUint64(&a.dropped, 1)
+		return
+	}
+	c := m.clone()
+	switch a.overflow {
+	case OverflowDropNewest:
+		select {
+		case a.queue <- c:
+		default:
+			atomic.AddUint64(&a.dropped, 1)
+			putMessage(c)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case a.queue <- c:
+				return
+			default:
+			}
+			select {
+			case old := <-a.queue:
+				atomic.AddUint64(&a.dropped, 1)
+				putMessage(old)
+			default:
+			}
+		}
+	default:
+		a.queue <- c
+	}
+}
+
+func (a *AsyncWriter) run() {
+	for m := range a.queue {
+		a.Appender.Append(m)
+		putMessage(m)
+	}
+	close(a.done)
+}
+
+// Dropped returns the number of messages discarded because the queue was full
+// or the appender was closed.
+func (a *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Queued returns the number of messages waiting to be delivered.
+func (a *AsyncWriter) Queued() int {
+	return len(a.queue)
+}
+
+// Close delivers any queued messages, then closes the wrapped appender.
+func (a *AsyncWriter) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+	<-a.done
+	a.closeOnce.Do(a.Appender.Close)
+}
+
+func (a *AsyncWriter) setName(name string) {
+	if n, ok := a.Appender.(interface {
+		setName(string)
+	}); ok {
+		n.setName(name)
+	}
+}
@@ -0,0 +1,141 @@
+package logo
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedAppender blocks each Append until released.
+type gatedAppender struct {
+	emptyAppender
+	mu      sync.Mutex
+	gate    chan struct{}
+	started chan struct{}
+	lines   []int
+}
+
+func newGatedAppender() *gatedAppender {
+	return &gatedAppender{gate: make(chan struct{}), started: make(chan struct{}, 100)}
+}
+
+func (a *gatedAppender) Append(m *LogMessage) {
+	a.started <- struct{}{}
+	<-a.gate
+	a.mu.Lock()
+	a.lines = append(a.lines, m.line)
+	a.mu.Unlock()
+}
+
+func TestAsyncAppenderDeliversCopyOfMessage(t *testing.T) {
+	want := "2016-04-09 18:03:28.342017 INFO (sample.go:456) - Test 34 (56)\n"
+
+	ta := newTestAppender()
+	appender := AsyncAppender(ta, AsyncConfig{})
+	m := testMessage()
+	appender.Append(m)
+	m.args[0] = 99
+	m.line = 0
+	appender.Close()
+
+	if len(ta.Messages) != 1 {
+		t.Fatalf("Message count got %d, want 1", len(ta.Messages))
+	}
+	got := ta.Messages[0]
+	if got != want {
+		t.Errorf("Message got %q, want %q", got, want)
+	}
+	if !ta.Closed {
+		t.Errorf("Wrapped appender not closed")
+	}
+}
+
+func TestAsyncAppenderOverflowPolicies(t *testing.T) {
+	var tests = []struct {
+		property    string
+		overflow    OverflowPolicy
+		wantLines   []int
+		wantDropped uint64
+	}{
+		{"drop newest", OverflowDropNewest, []int{1, 2, 3}, 2},
+		{"drop oldest", OverflowDropOldest, []int{1, 4, 5}, 2},
+	}
+
+	for _, test := range tests {
+		ga := newGatedAppender()
+		appender := AsyncAppender(ga, AsyncConfig{QueueSize: 2, Overflow: test.overflow})
+		for i := 1; i <= 5; i++ {
+			m := testMessage()
+			m.line = i
+			appender.Append(m)
+			if i == 1 {
+				<-ga.started // first message is being delivered
+			}
+		}
+		got := appender.Dropped()
+		close(ga.gate)
+		appender.Close()
+
+		if got != test.wantDropped {
+			t.Errorf("%s dropped got %d, want %d", test.property, got, test.wantDropped)
+		}
+		if len(ga.lines) != len(test.wantLines) {
+			t.Errorf("%s delivered got %v, want %v", test.property, ga.lines, test.wantLines)
+			continue
+		}
+		for i, l := range test.wantLines {
+			if ga.lines[i] != l {
+				t.Errorf("%s delivered got %v, want %v", test.property, ga.lines, test.wantLines)
+				break
+			}
+		}
+	}
+}
+
+func TestAsyncAppenderBlocksWhenQueueFull(t *testing.T) {
+	ga := newGatedAppender()
+	appender := AsyncAppender(ga, AsyncConfig{QueueSize: 1})
+	appender.Append(testMessage())
+	<-ga.started
+	appender.Append(testMessage())
+
+	done := make(chan struct{})
+	go func() {
+		appender.Append(testMessage())
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatalf("Append did not block when queue full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(ga.gate)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Append still blocked after queue drained")
+	}
+	appender.Close()
+
+	if got := len(ga.lines); got != 3 {
+		t.Errorf("Delivered count got %d, want 3", got)
+	}
+	if got := appender.Dropped(); got != 0 {
+		t.Errorf("Dropped got %d, want 0", got)
+	}
+}
+
+func TestAsyncAppenderDropsMessagesAfterClose(t *testing.T) {
+	ta := newTestAppender()
+	appender := AsyncAppender(ta, AsyncConfig{})
+	appender.Close()
+	appender.Append(testMessage())
+	appender.Close()
+
+	if got := appender.Dropped(); got != 1 {
+		t.Errorf("Dropped got %d, want 1", got)
+	}
+	if got := len(ta.Messages); got != 0 {
+		t.Errorf("Message count got %d, want 0", got)
+	}
+}
@@ -0,0 +1,194 @@
+package logo
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ColorMode determines whether the ConsoleAppender colours its output.
+type ColorMode int
+
+const (
+	// ColorNever disables colouring. This is the default.
+	ColorNever ColorMode = iota
+	// ColorAuto colours output only when it is written to a terminal, and
+	// the NO_COLOR environment variable is not set.
+	ColorAuto
+	// ColorAlways colours output regardless of where it is written.
+	ColorAlways
+)
+
+var colorModeName = []string{"never", "auto", "always"}
+
+func (c ColorMode) String() string {
+	if c < 0 || int(c) >= len(colorModeName) {
+		return fmt.Sprintf("ColorMode(%d)", int(c))
+	}
+	return colorModeName[c]
+}
+
+// parseColorMode returns the ColorMode with the name n, e.g. "auto".
+func parseColorMode(n string) (ColorMode, error) {
+	for i, s := range colorModeName {
+		if strings.EqualFold(s, n) {
+			return ColorMode(i), nil
+		}
+	}
+	return ColorNever, fmt.Errorf("unrecognised color mode %q", n)
+}
+
+// colorCodes maps color and attribute names to ANSI SGR parameters.
+var colorCodes = map[string]int{
+	"bold":      1,
+	"faint":     2,
+	"italic":    3,
+	"underline": 4,
+	"black":     30,
+	"red":       31,
+	"green":     32,
+	"yellow":    33,
+	"blue":      34,
+	"magenta":   35,
+	"cyan":      36,
+	"white":     37,
+	"gray":      90,
+	"grey":      90,
+}
+
+// defaultColors is the palette used unless changed with SetColors.
+var defaultColors = map[string]string{
+	"debug": "cyan",
+	"info":  "green",
+	"warn":  "yellow",
+	"error": "red",
+	"panic": "bold red",
+	"fatal": "bold magenta",
+}
+
+// defaultPalette returns the escape sequences for defaultColors, indexed by
+// severity.
+func defaultPalette() []string {
+	p := make([]string, none)
+	parsePalette(defaultColors, p)
+	return p
+}
+
+const colorReset = "\x1b[0m"
+
+// parseColor converts a space separated list of color and attribute names
+// (or numeric SGR parameters), e.g. "bold red", to an ANSI escape sequence.
+// An empty list returns an empty sequence.
+func parseColor(c string) (string, error) {
+	fields := strings.Fields(c)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	codes := make([]string, len(fields))
+	for i, f := range fields {
+		if n, ok := colorCodes[strings.ToLower(f)]; ok {
+			codes[i] = strconv.Itoa(n)
+		} else if n, err := strconv.Atoi(f); err == nil && n >= 0 && n <= 255 {
+			codes[i] = f
+		} else {
+			return "", fmt.Errorf("unrecognised color %q", f)
+		}
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m", nil
+}
+
+// parsePalette converts a map of level names to colors, into escape
+// sequences indexed by severity.
+func parsePalette(colors map[string]string, palette []string) error {
+	for n, c := range colors {
+		s, err := parseSeverity(n)
+		if err != nil || s == none {
+			return fmt.Errorf("unrecognised level %q", n)
+		}
+		esc, err := parseColor(c)
+		if err != nil {
+			return fmt.Errorf("%s: %v", n, err)
+		}
+		palette[s] = esc
+	}
+	return nil
+}
+
+// isTerminal reports whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// SetColorMode determines whether messages are coloured according to their
+// severity. With ColorAuto, messages are only coloured if the appender
+// writes to a terminal and the NO_COLOR environment variable is empty, so
+// output redirected to a file or pipe stays plain. The environment and
+// terminal are checked when SetColorMode is called.
+func (a *ConsoleWriter) SetColorMode(mode ColorMode) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch mode {
+	case ColorAlways:
+		a.colored = true
+	case ColorAuto:
+		a.colored = os.Getenv("NO_COLOR") == "" && isTerminal(a.out)
+	default:
+		a.colored = false
+	}
+}
+
+// SetColors changes the colors used for each severity, when colouring is
+// enabled with SetColorMode. Colors is keyed by level name, e.g. "warn", and
+// each value is a space separated list of color and attribute names, e.g.
+// "bold red", or numeric ANSI SGR parameters, e.g. "38 5 208". An empty
+// value disables colouring for the level. Levels which are not included keep
+// their current color. The supported names are: black, red, green, yellow,
+// blue, magenta, cyan, white, gray, bold, faint, italic and underline.
+func (a *ConsoleWriter) SetColors(colors map[string]string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	palette := append([]string(nil), a.palette...)
+	if err := parsePalette(colors, palette); err != nil {
+		return err
+	}
+	a.palette = palette
+	return nil
+}
+
+// writeColored writes p wrapped in the escape sequences for severity s. Any
+// trailing newline is written after the reset sequence, so that a colored
+// background does not spill onto the next line. Messages without a palette
+// entry, such as those captured from the standard logger, are written
+// uncolored. It must be called with a.mu held.
+func (a *ConsoleWriter) writeColored(s Severity, p []byte) (int, error) {
+	var esc string
+	if s >= 0 && int(s) < len(a.palette) {
+		esc = a.palette[s]
+	}
+	if esc == "" {
+		return a.out.Write(p)
+	}
+	n := len(p)
+	for n > 0 && (p[n-1] == '\n' || p[n-1] == '\r') {
+		n--
+	}
+	b := append(a.scratch[:0], esc...)
+	b = append(b, p[:n]...)
+	b = append(b, colorReset...)
+	b = append(b, p[n:]...)
+	a.scratch = b
+	if _, err := a.out.Write(b); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,114 @@
+package logo
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestConsoleAppenderColorMode(t *testing.T) {
+	var tests = []struct {
+		mode     ColorMode
+		noColor  string
+		severity Severity
+		want     string
+	}{
+		{ColorNever, "", WarnLevel, "WARN Test 34 (56)\n"},
+		{ColorAlways, "", WarnLevel, "\x1b[33mWARN Test 34 (56)\x1b[0m\n"},
+		{ColorAlways, "", PanicLevel, "\x1b[1;31mPANIC Test 34 (56)\x1b[0m\n"},
+		{ColorAlways, "1", InfoLevel, "\x1b[32mINFO Test 34 (56)\x1b[0m\n"},
+		{ColorAuto, "", InfoLevel, "INFO Test 34 (56)\n"}, // not a terminal
+	}
+
+	defer os.Unsetenv("NO_COLOR")
+	for _, test := range tests {
+		os.Setenv("NO_COLOR", test.noColor)
+		appender := newConsoleAppender()
+		var b bytes.Buffer
+		appender.out = &b
+		appender.SetFormat("%s %m%n")
+		appender.SetColorMode(test.mode)
+
+		m := testMessage()
+		m.severity = test.severity
+		appender.Append(m)
+		if got := b.String(); got != test.want {
+			t.Errorf("%v %v got %q, want %q", test.mode, test.severity, got, test.want)
+		}
+	}
+}
+
+func TestConsoleAppenderSetColors(t *testing.T) {
+	appender := newConsoleAppender()
+	var b bytes.Buffer
+	appender.out = &b
+	appender.SetFormat("%s")
+	appender.SetColorMode(ColorAlways)
+	err := appender.SetColors(map[string]string{"info": "bold blue", "debug": "38 5 208", "warn": ""})
+	if err != nil {
+		t.Fatalf("SetColors error: %v", err)
+	}
+
+	var tests = []struct {
+		severity Severity
+		want     string
+	}{
+		{InfoLevel, "\x1b[1;34mINFO\x1b[0m"},
+		{DebugLevel, "\x1b[38;5;208mDEBUG\x1b[0m"},
+		{WarnLevel, "WARN"},
+		{ErrorLevel, "\x1b[31mERROR\x1b[0m"}, // unchanged
+	}
+	for _, test := range tests {
+		b.Reset()
+		m := testMessage()
+		m.severity = test.severity
+		appender.Append(m)
+		if got := b.String(); got != test.want {
+			t.Errorf("%v got %q, want %q", test.severity, got, test.want)
+		}
+	}
+}
+
+func TestConsoleAppenderSetColorsReturnsErrorWhenInvalid(t *testing.T) {
+	var tests = []struct {
+		colors map[string]string
+		want   string
+	}{
+		{map[string]string{"loud": "red"}, `unrecognised level "loud"`},
+		{map[string]string{"none": "red"}, `unrecognised level "none"`},
+		{map[string]string{"error": "bold crimson"}, `error: unrecognised color "crimson"`},
+		{map[string]string{"error": "300"}, `error: unrecognised color "300"`},
+	}
+
+	appender := newConsoleAppender()
+	for _, test := range tests {
+		err := appender.SetColors(test.colors)
+		if err == nil {
+			t.Errorf("%v got <nil>, want %q", test.colors, test.want)
+			continue
+		}
+		if got := err.Error(); got != test.want {
+			t.Errorf("%v got %q, want %q", test.colors, got, test.want)
+		}
+	}
+}
+
+func TestConsoleAppenderWritesCapturedStandardLogUncolored(t *testing.T) {
+	defer reset()
+	defer log.SetOutput(os.Stderr)
+	defer log.SetFlags(log.Flags())
+	appender := newConsoleAppender()
+	var b bytes.Buffer
+	appender.out = &b
+	appender.SetFormat("%m%n")
+	appender.SetColorMode(ColorAlways)
+	AddAppender("colored", appender)
+
+	CaptureStandardLog("colored")
+	log.Print("bridged")
+
+	if got, want := b.String(), "bridged\n"; got != want {
+		t.Errorf("Message got %q, want %q", got, want)
+	}
+}
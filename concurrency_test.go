@@ -0,0 +1,156 @@
+package logo
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// These tests are intended to be run with the race detector:
+//
+//   go test -race
+
+type countingAppender struct {
+	emptyAppender
+	count int64
+}
+
+func (a *countingAppender) Append(m *LogMessage) {
+	for _, f := range []Formatter{&messageFormatter{}, &propertyFormatter{name: "global"}} {
+		f.Format(m)
+	}
+	atomic.AddInt64(&a.count, 1)
+}
+
+func TestConcurrentConfigurationChangesWhileLogging(t *testing.T) {
+	defer reset()
+	appender := &countingAppender{}
+	AddAppender("count", appender)
+	l := New("Test", "debug")
+	l.SetAppenders("count")
+	SetAppenders("count")
+	cl := l.WithContextProperties(map[string]interface{}{"user": 1})
+
+	const n = 200
+	var wg sync.WaitGroup
+	run := func(f func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				f(i)
+			}
+		}()
+	}
+
+	run(func(i int) { l.Infof("message %d", i) })
+	run(func(i int) { cl.Info("context message", i) })
+	run(func(i int) { Debug("default message", i) })
+	run(func(i int) { SetGlobalProperty("global", i) })
+	run(func(i int) { l.SetContextProperty("local", i) })
+	run(func(i int) { cl.SetContextProperty("user", i) })
+	run(func(i int) { SetManagerLevel("debug") })
+	run(func(i int) { AddAppender(fmt.Sprintf("empty%d", i), &emptyAppender{}) })
+	run(func(i int) { New(fmt.Sprintf("logger%d", i), "info") })
+	run(func(i int) { LoggerByName(fmt.Sprintf("byname%d", i%10)) })
+	run(func(i int) { l.SetAppenders("count", fmt.Sprintf("empty%d", i/2)) })
+	run(func(i int) { SetErrorHandler(DiscardErrorHandler) })
+	wg.Wait()
+
+	if got := atomic.LoadInt64(&appender.count); got < 2*n {
+		t.Errorf("Appended count got %d, want at least %d", got, 2*n)
+	}
+}
+
+func TestContextPropertiesAreCopiedOnWrite(t *testing.T) {
+	defer reset()
+	appender := newTestAppender()
+	AddAppender("test", appender)
+	l := New("Test", "debug")
+	l.SetAppenders("test")
+	l.SetContextProperty("p", 1)
+	SetGlobalProperty("g", 1)
+
+	l.Debug("first")
+	l.SetContextProperty("p", 2)
+	SetGlobalProperty("g", 2)
+	l.Debug("second")
+
+	var tests = []struct {
+		index int
+		key   string
+		want  interface{}
+	}{
+		{0, "p", 1},
+		{0, "g", 1},
+		{1, "p", 2},
+		{1, "g", 2},
+	}
+	for _, test := range tests {
+		got := appender.logMessages[test.index].properties[test.key]
+		if got != test.want {
+			t.Errorf("Message %d property %q got %v, want %v", test.index, test.key, got, test.want)
+		}
+	}
+}
+
+func TestConcurrentApplyConfig(t *testing.T) {
+	defer reset()
+	// ids records the options each appender was built with; building yields,
+	// as real appenders block while connecting
+	ids := make(map[Appender]int)
+	appenderTypes["test"] = func(options json.RawMessage) (Appender, error) {
+		var o struct {
+			ID int `json:"id"`
+		}
+		if err := decodeOptions(options, &o); err != nil {
+			return nil, err
+		}
+		runtime.Gosched()
+		a := newTestAppender()
+		ids[a] = o.ID
+		return a, nil
+	}
+	defer delete(appenderTypes, "test")
+	l := New("db", "info")
+
+	const n = 50
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				config := fmt.Sprintf(`{
+				  "appenders": {"a": {"type": "test", "options": {"id": %d}}},
+				  "loggers": {"db": {"appenders": ["a"]}}
+				}`, (g+i)%2)
+				if err := Configure(strings.NewReader(config)); err != nil {
+					t.Errorf("Configure error: %v", err)
+					return
+				}
+				runtime.Gosched()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	current, _ := manager.appender("a")
+	for a := range ids {
+		if closed := a.(*testAppender).Closed; a == current && closed {
+			t.Errorf("Current appender closed")
+		} else if a != current && !closed {
+			t.Errorf("Replaced appender not closed")
+		}
+	}
+	if got, want := string(manager.configured["a"].Options), fmt.Sprintf(`{"id": %d}`, ids[current]); got != want {
+		t.Errorf("Configured options got %s, want %s", got, want)
+	}
+	if got := l.load().appenders; len(got) != 1 || got[0] != current {
+		t.Errorf("Logger appenders got %v, want [%v]", got, current)
+	}
+}
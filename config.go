@@ -0,0 +1,750 @@
+package logo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config describes a complete logging configuration: the manager level,
+// global properties, appenders and loggers. A Config is normally loaded from
+// a JSON document using Configure or LoadConfig, for example:
+//
+//   {
+//     "level": "info",
+//     "properties": {"cluster-id": "eu-west-1"},
+//     "appenders": {
+//       "file": {
+//         "type": "rollingfile",
+//         "format": "%date %severity %logger - %message%newline",
+//         "filters": ["info", "warn", "error", "panic", "fatal"],
+//         "async": {"queueSize": 5000, "overflow": "drop-oldest"},
+//         "options": {"filename": "service.log", "maxFileSize": 5, "maxAge": "168h"}
+//       },
+//       "console": {"format": "%severity %message%newline"}
+//     },
+//     "loggers": {
+//       "": {"level": "debug", "appenders": ["console"]},
+//       "db": {"level": "warn", "appenders": ["file", "console"]}
+//     }
+//   }
+//
+// Only JSON is supported: the appender options are held as raw JSON (see
+// AppenderConfig). A Config built in code can be applied with ApplyConfig.
+type Config struct {
+	Level      string                    `json:"level,omitempty"`
+	Properties map[string]interface{}    `json:"properties,omitempty"`
+	Appenders  map[string]AppenderConfig `json:"appenders,omitempty"`
+	Loggers    map[string]LoggerConfig   `json:"loggers,omitempty"`
+}
+
+// AppenderConfig describes an appender. Type is one of the registered appender
+// types (e.g. "console", "stdout" or "rollingfile") and Options holds the type
+// specific settings; for "rollingfile", "syslog", "socket", "http" and
+// "journald" these correspond to the fields of the appender's config struct,
+// e.g. RollingFileConfig (except for the HTTPConfig DeadLetter and Client),
+// and "console" and "stdout" accept "color" (e.g. "auto") and "colors" (see
+// SetColors). Durations are specified as strings, e.g. "24h", and TLS
+// settings as an object with "caFile", "certFile", "keyFile", "serverName"
+// and "insecureSkipVerify".
+// If Type is empty, the appender must already have been added to the log
+// manager (e.g. the standard "console" appender), and only its format and
+// filters are changed. If Async is specified, the appender is
+// wrapped in an AsyncAppender. Options must be a JSON object, e.g.
+// json.RawMessage(`{"filename": "service.log"}`).
+type AppenderConfig struct {
+	Type    string          `json:"type,omitempty"`
+	Format  string          `json:"format,omitempty"`
+	Filters []string        `json:"filters,omitempty"`
+	Async   *AsyncConfig    `json:"async,omitempty"`
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+// LoggerConfig describes a named logger. The default logger has the name "".
+type LoggerConfig struct {
+	Level     string   `json:"level,omitempty"`
+	Appenders []string `json:"appenders,omitempty"`
+}
+
+// ConfigError is returned when a configuration is invalid. Key identifies the
+// offending setting, e.g. "appenders.file.options.maxAge".
+type ConfigError struct {
+	Key string
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("logo: config: %v", e.Err)
+	}
+	return fmt.Sprintf("logo: config: %s: %v", e.Key, e.Err)
+}
+
+// appenderTypes maps appender type names to functions which build an
+// appender from its configuration options.
+var appenderTypes = map[string]func(options json.RawMessage) (Appender, error){
+	"console":     newConsoleAppenderFromOptions,
+	"stdout":      newStdoutAppenderFromOptions,
+	"rollingfile": newRollingFileAppenderFromOptions,
+	"syslog":      newSyslogAppenderFromOptions,
+	"socket":      newSocketAppenderFromOptions,
+	"http":        newHTTPAppenderFromOptions,
+	"journald":    newJournaldAppenderFromOptions,
+}
+
+type consoleOptions struct {
+	Color  string            `json:"color"`
+	Colors map[string]string `json:"colors"`
+}
+
+func newConsoleAppenderFromOptions(options json.RawMessage) (Appender, error) {
+	return newWriterAppenderFromOptions(options, os.Stderr)
+}
+
+func newStdoutAppenderFromOptions(options json.RawMessage) (Appender, error) {
+	return newWriterAppenderFromOptions(options, os.Stdout)
+}
+
+func newWriterAppenderFromOptions(options json.RawMessage, w io.Writer) (Appender, error) {
+	var o consoleOptions
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	a := WriterAppender(w)
+	if o.Color != "" {
+		mode, err := parseColorMode(o.Color)
+		if err != nil {
+			return nil, &ConfigError{Key: "color", Err: err}
+		}
+		a.SetColorMode(mode)
+	}
+	if err := a.SetColors(o.Colors); err != nil {
+		return nil, &ConfigError{Key: "colors", Err: err}
+	}
+	return a, nil
+}
+
+type rollingFileOptions struct {
+	Filename          string   `json:"filename"`
+	MaxFileSize       int      `json:"maxFileSize"`
+	PreserveExtension bool     `json:"preserveExtension"`
+	MaxBackups        int      `json:"maxBackups"`
+	MaxAge            duration `json:"maxAge"`
+	MaxTotalSize      int      `json:"maxTotalSize"`
+	RollInterval      duration `json:"rollInterval"`
+	Compress          bool     `json:"compress"`
+	StableFilename    bool     `json:"stableFilename"`
+	AppendExisting    bool     `json:"appendExisting"`
+}
+
+func newRollingFileAppenderFromOptions(options json.RawMessage) (Appender, error) {
+	var o rollingFileOptions
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	if o.Filename == "" {
+		return nil, &ConfigError{Key: "filename", Err: fmt.Errorf("required")}
+	}
+	return RollingFileAppender(RollingFileConfig{
+		Filename:          o.Filename,
+		MaxFileSize:       o.MaxFileSize,
+		PreserveExtension: o.PreserveExtension,
+		MaxBackups:        o.MaxBackups,
+		MaxAge:            time.Duration(o.MaxAge),
+		MaxTotalSize:      o.MaxTotalSize,
+		RollInterval:      time.Duration(o.RollInterval),
+		Compress:          o.Compress,
+		StableFilename:    o.StableFilename,
+		AppendExisting:    o.AppendExisting,
+	})
+}
+
+type syslogOptions struct {
+	Network          string      `json:"network"`
+	Address          string      `json:"address"`
+	TLS              *tlsOptions `json:"tls"`
+	RFC3164          bool        `json:"rfc3164"`
+	Facility         string      `json:"facility"`
+	AppName          string      `json:"appName"`
+	Hostname         string      `json:"hostname"`
+	StructuredDataID string      `json:"structuredDataId"`
+	DialTimeout      duration    `json:"dialTimeout"`
+}
+
+func newSyslogAppenderFromOptions(options json.RawMessage) (Appender, error) {
+	var o syslogOptions
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	tc, err := o.TLS.config()
+	if err != nil {
+		return nil, &ConfigError{Key: "tls", Err: err}
+	}
+	return SyslogAppender(SyslogConfig{
+		Network:          o.Network,
+		Address:          o.Address,
+		TLSConfig:        tc,
+		RFC3164:          o.RFC3164,
+		Facility:         o.Facility,
+		AppName:          o.AppName,
+		Hostname:         o.Hostname,
+		StructuredDataID: o.StructuredDataID,
+		DialTimeout:      time.Duration(o.DialTimeout),
+	})
+}
+
+type socketOptions struct {
+	Network     string      `json:"network"`
+	Address     string      `json:"address"`
+	TLS         *tlsOptions `json:"tls"`
+	Framing     Framing     `json:"framing"`
+	BufferSize  int         `json:"bufferSize"`
+	MinBackoff  duration    `json:"minBackoff"`
+	MaxBackoff  duration    `json:"maxBackoff"`
+	DialTimeout duration    `json:"dialTimeout"`
+}
+
+func newSocketAppenderFromOptions(options json.RawMessage) (Appender, error) {
+	var o socketOptions
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	tc, err := o.TLS.config()
+	if err != nil {
+		return nil, &ConfigError{Key: "tls", Err: err}
+	}
+	a, err := SocketAppender(SocketConfig{
+		Network:     o.Network,
+		Address:     o.Address,
+		TLSConfig:   tc,
+		Framing:     o.Framing,
+		BufferSize:  o.BufferSize,
+		MinBackoff:  time.Duration(o.MinBackoff),
+		MaxBackoff:  time.Duration(o.MaxBackoff),
+		DialTimeout: time.Duration(o.DialTimeout),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+type httpOptions struct {
+	URL          string            `json:"url"`
+	Headers      map[string]string `json:"headers"`
+	Encoding     HTTPEncoding      `json:"encoding"`
+	Gzip         bool              `json:"gzip"`
+	BatchSize    int               `json:"batchSize"`
+	BatchBytes   int               `json:"batchBytes"`
+	BatchLatency duration          `json:"batchLatency"`
+	QueueSize    int               `json:"queueSize"`
+	MaxRetries   int               `json:"maxRetries"`
+	MinBackoff   duration          `json:"minBackoff"`
+	MaxBackoff   duration          `json:"maxBackoff"`
+	Timeout      duration          `json:"timeout"`
+}
+
+func newHTTPAppenderFromOptions(options json.RawMessage) (Appender, error) {
+	var o httpOptions
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	if o.URL == "" {
+		return nil, &ConfigError{Key: "url", Err: fmt.Errorf("required")}
+	}
+	a, err := HTTPAppender(HTTPConfig{
+		URL:          o.URL,
+		Headers:      o.Headers,
+		Encoding:     o.Encoding,
+		Gzip:         o.Gzip,
+		BatchSize:    o.BatchSize,
+		BatchBytes:   o.BatchBytes,
+		BatchLatency: time.Duration(o.BatchLatency),
+		QueueSize:    o.QueueSize,
+		MaxRetries:   o.MaxRetries,
+		MinBackoff:   time.Duration(o.MinBackoff),
+		MaxBackoff:   time.Duration(o.MaxBackoff),
+		Timeout:      time.Duration(o.Timeout),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+type journaldOptions struct {
+	SocketPath       string `json:"socketPath"`
+	SyslogIdentifier string `json:"syslogIdentifier"`
+}
+
+func newJournaldAppenderFromOptions(options json.RawMessage) (Appender, error) {
+	var o journaldOptions
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	return JournaldAppender(JournaldConfig{
+		SocketPath:       o.SocketPath,
+		SyslogIdentifier: o.SyslogIdentifier,
+	})
+}
+
+// tlsOptions are the TLS settings of the network appenders. The CA file is
+// used to verify the server, and the certificate and key files are used for
+// client authentication.
+type tlsOptions struct {
+	CAFile             string `json:"caFile"`
+	CertFile           string `json:"certFile"`
+	KeyFile            string `json:"keyFile"`
+	ServerName         string `json:"serverName"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
+// config returns the tls.Config for the options, or nil if o is nil.
+func (o *tlsOptions) config() (*tls.Config, error) {
+	if o == nil {
+		return nil, nil
+	}
+	c := &tls.Config{
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if o.CAFile != "" {
+		pem, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.CAFile)
+		}
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// decodeOptions decodes appender options into the struct pointed to by v.
+// Each option is decoded separately so that any error identifies the key.
+func decodeOptions(options json.RawMessage, v interface{}) error {
+	if len(options) == 0 {
+		return nil
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(options, &raw); err != nil {
+		return &ConfigError{Err: err}
+	}
+
+	rv := reflect.ValueOf(v).Elem()
+	fields := make(map[string]reflect.Value)
+	for i := 0; i < rv.NumField(); i++ {
+		tag := strings.Split(rv.Type().Field(i).Tag.Get("json"), ",")[0]
+		fields[tag] = rv.Field(i)
+	}
+
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f, ok := fields[k]
+		if !ok {
+			return &ConfigError{Key: k, Err: fmt.Errorf("unknown option")}
+		}
+		if err := json.Unmarshal(raw[k], f.Addr().Interface()); err != nil {
+			return &ConfigError{Key: k, Err: err}
+		}
+	}
+	return nil
+}
+
+// duration is a time.Duration which is specified in configuration files as a
+// string, e.g. "1h30m", or one of the names "hourly" and "daily".
+type duration time.Duration
+
+func (d *duration) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "hourly":
+		*d = duration(RollHourly)
+	case "daily":
+		*d = duration(RollDaily)
+	default:
+		v, err := time.ParseDuration(string(text))
+		if err != nil {
+			return err
+		}
+		*d = duration(v)
+	}
+	return nil
+}
+
+// LoadConfig reads a JSON configuration from the named file and applies it.
+// See Config for details of the format. The path is remembered, so that the
+// file can be applied again with Reload.
+func LoadConfig(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	defer f.Close()
+	if err := Configure(f); err != nil {
+		return err
+	}
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.configPath = path
+	return nil
+}
+
+// configMu serializes calls to ApplyConfig, so that a reload cannot
+// interleave with another reload or an administrative change.
+var configMu sync.Mutex
+
+// Configure reads a JSON configuration from r and applies it.
+// See Config for details of the format.
+func Configure(r io.Reader) error {
+	var c Config
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&c); err != nil {
+		return &ConfigError{Err: err}
+	}
+	return ApplyConfig(c)
+}
+
+// ApplyConfig applies the configuration c. The configuration is validated,
+// and all new appenders are created, before any changes are made; if an error
+// is returned, the existing configuration is unchanged.
+// New appenders are added to the log manager, and named loggers are created
+// if they do not already exist; existing loggers are updated.
+//
+// ApplyConfig can be called again at runtime to reconfigure logging. Appenders
+// created by a previous call are reused if their type and options are
+// unchanged, otherwise they are replaced, and any which are no longer in the
+// configuration are removed. Loggers using a replaced or removed appender are
+// switched to its replacement, or stop using it, and the old appender is then
+// closed. Loggers not in the configuration are otherwise left unchanged.
+// Concurrent calls are applied one at a time.
+//
+// The changes are not made atomically. The formats and filters of existing
+// appenders are changed first, then the appenders are swapped, then the
+// manager level, properties and each logger are updated in turn; each logger
+// changes in a single step, but messages logged during the call may see some
+// loggers with the old configuration and some with the new.
+func ApplyConfig(c Config) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	var level Severity
+	if c.Level != "" {
+		var err error
+		if level, err = parseSeverity(c.Level); err != nil {
+			return &ConfigError{Key: "level", Err: err}
+		}
+	}
+
+	names := sortedKeys(c.Appenders)
+	for _, name := range names {
+		if err := validateAppender(name, c.Appenders[name]); err != nil {
+			return err
+		}
+	}
+
+	loggers := make([]string, 0, len(c.Loggers))
+	for name := range c.Loggers {
+		loggers = append(loggers, name)
+	}
+	sort.Strings(loggers)
+	for _, name := range loggers {
+		if err := validateLogger(name, c.Loggers[name], c.Appenders); err != nil {
+			return err
+		}
+	}
+
+	// build new appenders before making any changes
+	manager.mu.Lock()
+	previous := manager.configured
+	manager.mu.Unlock()
+	built := make(map[string]Appender)
+	closeAll := func() {
+		for _, a := range built {
+			a.Close()
+		}
+	}
+	for _, name := range names {
+		ac := c.Appenders[name]
+		if ac.Type == "" {
+			continue
+		}
+		if old, ok := previous[name]; ok && reusable(old, ac) {
+			continue
+		}
+		a, err := buildAppender(name, ac)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		built[name] = a
+	}
+
+	// check that no appender has been added with the same name as a new one
+	// since the configuration was validated, then reconfigure the existing
+	// appenders
+	manager.mu.Lock()
+	for _, name := range names {
+		_, isNew := built[name]
+		_, exists := manager.appenders[name]
+		if _, ok := previous[name]; isNew && exists && !ok {
+			manager.mu.Unlock()
+			closeAll()
+			return &ConfigError{Key: "appenders." + name, Err: fmt.Errorf("appender already exist")}
+		}
+	}
+	for _, name := range names {
+		if _, ok := built[name]; ok {
+			continue
+		}
+		if err := configureAppender(manager.appenders[name], c.Appenders[name]); err != nil {
+			manager.mu.Unlock()
+			closeAll()
+			return &ConfigError{Key: "appenders." + name + ".format", Err: err}
+		}
+	}
+
+	// swap the appenders, remembering those which are replaced or removed
+	var replaced, removed []Appender
+	var replacements []Appender
+	configured := make(map[string]AppenderConfig)
+	for _, name := range names {
+		ac := c.Appenders[name]
+		if ac.Type == "" {
+			continue
+		}
+		configured[name] = ac
+		a, ok := built[name]
+		if !ok {
+			continue
+		}
+		if old, ok := manager.appenders[name]; ok {
+			replaced = append(replaced, old)
+			replacements = append(replacements, a)
+		}
+		if n, ok := a.(interface {
+			setName(string)
+		}); ok {
+			n.setName(name)
+		}
+		manager.appenders[name] = a
+	}
+	for name := range previous {
+		if _, ok := configured[name]; !ok {
+			removed = append(removed, manager.appenders[name])
+			delete(manager.appenders, name)
+		}
+	}
+	manager.configured = configured
+	managed := make([]*Logger, 0, len(manager.loggers))
+	for _, l := range manager.loggers {
+		managed = append(managed, l)
+	}
+	manager.mu.Unlock()
+
+	if len(replaced) > 0 || len(removed) > 0 {
+		for _, l := range managed {
+			l.update(func(c *loggerConfig) {
+				c.appenders, c.appenderNames = remapAppenders(c.appenders, c.appenderNames, replaced, replacements, removed)
+			})
+		}
+	}
+
+	if c.Level != "" {
+		atomic.StoreInt32(&manager.level, int32(level))
+	}
+	for k, v := range c.Properties {
+		SetGlobalProperty(k, v)
+	}
+
+	for _, name := range loggers {
+		lc := c.Loggers[name]
+		l := LoggerByName(name)
+		if lc.Level != "" {
+			sev, _ := parseSeverity(lc.Level)
+			l.setLevel(sev)
+		}
+		if lc.Appenders != nil {
+			l.SetAppenders(lc.Appenders...)
+		}
+	}
+
+	for _, a := range append(replaced, removed...) {
+		a.Close()
+	}
+	return nil
+}
+
+// reusable reports whether an appender created from the configuration old
+// can be reconfigured to match c, rather than being replaced.
+func reusable(old, c AppenderConfig) bool {
+	if old.Type != c.Type || !reflect.DeepEqual(old.Async, c.Async) {
+		return false
+	}
+	if !equalJSON(old.Options, c.Options) {
+		return false
+	}
+	// the format and filters can be changed, but not restored to the defaults
+	return (c.Format != "" || old.Format == "") && (c.Filters != nil || old.Filters == nil)
+}
+
+// equalJSON reports whether a and b are equivalent JSON documents.
+func equalJSON(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if len(a) > 0 && json.Unmarshal(a, &va) != nil {
+		return false
+	}
+	if len(b) > 0 && json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// remapAppenders returns copies of appenders and their names in which each of
+// the replaced appenders is swapped for its replacement, and the removed
+// appenders are dropped.
+func remapAppenders(appenders []Appender, names []string, replaced, replacements, removed []Appender) ([]Appender, []string) {
+	result := make([]Appender, 0, len(appenders))
+	resultNames := make([]string, 0, len(names))
+next:
+	for i, a := range appenders {
+		for _, r := range removed {
+			if a == r {
+				continue next
+			}
+		}
+		for j, r := range replaced {
+			if a == r {
+				a = replacements[j]
+				break
+			}
+		}
+		result = append(result, a)
+		resultNames = append(resultNames, names[i])
+	}
+	return result, resultNames
+}
+
+func sortedKeys(m map[string]AppenderConfig) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func validateAppender(name string, c AppenderConfig) error {
+	key := "appenders." + name
+	manager.mu.Lock()
+	_, exists := manager.appenders[name]
+	_, configured := manager.configured[name]
+	manager.mu.Unlock()
+	if c.Type == "" {
+		if !exists || configured {
+			return &ConfigError{Key: key + ".type", Err: fmt.Errorf("required for new appender")}
+		}
+		if c.Async != nil || len(c.Options) > 0 {
+			return &ConfigError{Key: key, Err: fmt.Errorf("only format and filters can be changed for existing appender")}
+		}
+	} else if _, ok := appenderTypes[c.Type]; !ok {
+		return &ConfigError{Key: key + ".type", Err: fmt.Errorf("unknown appender type %q", c.Type)}
+	} else if exists && !configured {
+		return &ConfigError{Key: key, Err: fmt.Errorf("appender already exist")}
+	}
+	if c.Format != "" {
+		if _, err := extract(c.Format); err != nil {
+			return &ConfigError{Key: key + ".format", Err: err}
+		}
+	}
+	for i, f := range c.Filters {
+		if _, err := parseSeverity(f); err != nil {
+			return &ConfigError{Key: fmt.Sprintf("%s.filters[%d]", key, i), Err: err}
+		}
+	}
+	return nil
+}
+
+func validateLogger(name string, c LoggerConfig, appenders map[string]AppenderConfig) error {
+	key := "loggers." + name
+	if c.Level != "" {
+		if _, err := parseSeverity(c.Level); err != nil {
+			return &ConfigError{Key: key + ".level", Err: err}
+		}
+	}
+	for i, n := range c.Appenders {
+		if _, ok := appenders[n]; ok {
+			continue
+		}
+		// appenders created by a previous configuration are removed unless
+		// they are still configured
+		manager.mu.Lock()
+		_, ok := manager.appenders[n]
+		_, configured := manager.configured[n]
+		manager.mu.Unlock()
+		if !ok || configured {
+			return &ConfigError{Key: fmt.Sprintf("%s.appenders[%d]", key, i), Err: fmt.Errorf("unrecognised appender %q", n)}
+		}
+	}
+	return nil
+}
+
+// buildAppender creates a new appender from its configuration.
+func buildAppender(name string, c AppenderConfig) (Appender, error) {
+	key := "appenders." + name
+	a, err := appenderTypes[c.Type](c.Options)
+	if err != nil {
+		if ce, ok := err.(*ConfigError); ok {
+			k := key + ".options"
+			if ce.Key != "" {
+				k += "." + ce.Key
+			}
+			return nil, &ConfigError{Key: k, Err: ce.Err}
+		}
+		return nil, &ConfigError{Key: key, Err: err}
+	}
+	if err := configureAppender(a, c); err != nil {
+		a.Close()
+		return nil, &ConfigError{Key: key + ".format", Err: err}
+	}
+	if c.Async != nil {
+		a = AsyncAppender(a, *c.Async)
+	}
+	return a, nil
+}
+
+// configureAppender sets the format and filters of a, as specified in c,
+// returning any error from SetFormat.
+func configureAppender(a Appender, c AppenderConfig) error {
+	if c.Format != "" {
+		if err := a.SetFormat(c.Format); err != nil {
+			return err
+		}
+	}
+	if c.Filters != nil {
+		a.SetFilters(c.Filters...)
+	}
+	return nil
+}
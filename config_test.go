@@ -0,0 +1,174 @@
+package logo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigureBuildsLogging(t *testing.T) {
+	defer reset()
+	appender := newTestAppender()
+	AddAppender("test", appender)
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.log")
+
+	config := fmt.Sprintf(`{
+	  "level": "info",
+	  "properties": {"cluster": "c1"},
+	  "appenders": {
+	    "test": {"format": "%%s %%logger [%%p{cluster}] %%m", "filters": ["info", "error"]},
+	    "file": {
+	      "type": "rollingfile",
+	      "format": "%%s %%m%%n",
+	      "async": {"queueSize": 10, "overflow": "drop-newest"},
+	      "options": {"filename": %q, "maxFileSize": 1, "stableFilename": true, "maxAge": "24h"}
+	    }
+	  },
+	  "loggers": {
+	    "db": {"level": "debug", "appenders": ["test", "file"]},
+	    "": {"appenders": ["test"]}
+	  }
+	}`, filename)
+
+	if err := Configure(strings.NewReader(config)); err != nil {
+		t.Fatalf("Configure error: %v", err)
+	}
+
+	l := LoggerByName("db")
+	l.Debug("below manager level")
+	l.Info("configured")
+	l.Warn("filtered")
+	Error("default")
+	Close()
+
+	var tests = []struct {
+		property string
+		got      interface{}
+		want     interface{}
+	}{
+		{"manager level", manager.getLevel(), InfoLevel},
+		{"logger level", l.load().level, DebugLevel},
+		{"default logger appenders", len(defaultLogger.load().appenders), 1},
+		{"test messages", strings.Join(appender.Messages, "|"), "INFO db [c1] configured||ERROR  [c1] default"}, // warn filtered
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s got %v, want %v", test.property, test.got, test.want)
+		}
+	}
+
+	b, _ := ioutil.ReadFile(filename)
+	if got, want := string(b), "INFO configured\nWARN filtered\n"; got != want {
+		t.Errorf("File content got %q, want %q", got, want)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	defer reset()
+	path := filepath.Join(t.TempDir(), "logging.json")
+	ioutil.WriteFile(path, []byte(`{"level": "warn", "loggers": {"db": {"level": "error"}}}`), 0644)
+
+	if err := LoadConfig(path); err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+	if got := manager.getLevel(); got != WarnLevel {
+		t.Errorf("Manager level got %v, want %v", got, WarnLevel)
+	}
+	if got := LoggerByName("db").load().level; got != ErrorLevel {
+		t.Errorf("Logger level got %v, want %v", got, ErrorLevel)
+	}
+}
+
+func TestConfigureReturnsValidationErrors(t *testing.T) {
+	var tests = []struct {
+		config string
+		want   string
+	}{
+		{`{"level": "loud"}`, `logo: config: level: unrecognised level "loud"`},
+		{`{"appenders": {"a": {"type": "carrier-pigeon"}}}`, `logo: config: appenders.a.type: unknown appender type "carrier-pigeon"`},
+		{`{"appenders": {"a": {"format": "%m"}}}`, `logo: config: appenders.a.type: required for new appender`},
+		{`{"appenders": {"console": {"type": "console"}}}`, `logo: config: appenders.console: appender already exist`},
+		{`{"appenders": {"console": {"async": {}}}}`, `logo: config: appenders.console: only format and filters can be changed for existing appender`},
+		{`{"appenders": {"a": {"type": "console", "format": "%h"}}}`, `logo: config: appenders.a.format: invalid syntax at position 0, %h`},
+		{`{"appenders": {"a": {"type": "console", "filters": ["info", "loud"]}}}`, `logo: config: appenders.a.filters[1]: unrecognised level "loud"`},
+		{`{"appenders": {"a": {"type": "console", "options": {"colour": true}}}}`, `logo: config: appenders.a.options.colour: unknown option`},
+		{`{"appenders": {"a": {"type": "console", "options": {"color": "sometimes"}}}}`, `logo: config: appenders.a.options.color: unrecognised color mode "sometimes"`},
+		{`{"appenders": {"a": {"type": "console", "options": {"colors": {"warn": "orange"}}}}}`, `logo: config: appenders.a.options.colors: warn: unrecognised color "orange"`},
+		{`{"appenders": {"a": {"type": "rollingfile", "options": {"maxFileSize": 1}}}}`, `logo: config: appenders.a.options.filename: required`},
+		{`{"appenders": {"a": {"type": "http", "options": {"batchSize": 10}}}}`, `logo: config: appenders.a.options.url: required`},
+		{`{"appenders": {"a": {"type": "http", "options": {"url": "ftp://logs", "encoding": "xml"}}}}`, `logo: config: appenders.a.options.encoding: unrecognised encoding "xml"`},
+		{`{"appenders": {"a": {"type": "socket", "options": {"network": "tcp", "address": "localhost:5170", "framing": "crlf"}}}}`, `logo: config: appenders.a.options.framing: unrecognised framing "crlf"`},
+		{`{"appenders": {"a": {"type": "syslog", "options": {"network": "udp", "address": "localhost:514", "facility": "local9"}}}}`, `logo: config: appenders.a: syslog: unknown facility "local9"`},
+		{`{"appenders": {"a": {"type": "syslog", "options": {"network": "tls", "address": "localhost:6514", "tls": {"caFile": "missing.pem"}}}}}`, `logo: config: appenders.a.options.tls: open missing.pem: no such file or directory`},
+		{`{"appenders": {"a": {"type": "rollingfile", "options": {"filename": "x", "maxAge": "soon"}}}}`, `logo: config: appenders.a.options.maxAge: time: invalid duration "soon"`},
+		{`{"loggers": {"db": {"level": "loud"}}}`, `logo: config: loggers.db.level: unrecognised level "loud"`},
+		{`{"loggers": {"db": {"appenders": ["console", "missing"]}}}`, `logo: config: loggers.db.appenders[1]: unrecognised appender "missing"`},
+		{`{"levels": "info"}`, `logo: config: json: unknown field "levels"`},
+	}
+
+	for _, test := range tests {
+		reset()
+		err := Configure(strings.NewReader(test.config))
+		if err == nil {
+			t.Errorf("%s error <nil>, want %q", test.config, test.want)
+			continue
+		}
+		if got := err.Error(); got != test.want {
+			t.Errorf("%s error got %q, want %q", test.config, got, test.want)
+		}
+	}
+	reset()
+}
+
+func TestConfigureMakesNoChangesWhenInvalid(t *testing.T) {
+	defer reset()
+	config := `{
+	  "level": "error",
+	  "properties": {"p": 1},
+	  "appenders": {"a": {"type": "console"}},
+	  "loggers": {"db": {"level": "loud"}}
+	}`
+
+	if err := Configure(strings.NewReader(config)); err == nil {
+		t.Fatalf("Configure error <nil>, want error")
+	}
+
+	if got := manager.getLevel(); got != DebugLevel {
+		t.Errorf("Manager level got %v, want %v", got, DebugLevel)
+	}
+	if got := len(manager.getProperties()); got != 0 {
+		t.Errorf("Property count got %d, want 0", got)
+	}
+	if _, ok := manager.appender("a"); ok {
+		t.Errorf("Appender added")
+	}
+	if _, ok := manager.loggers["db"]; ok {
+		t.Errorf("Logger created")
+	}
+}
+
+func TestConfigureReturnsErrorWhenAppenderAddedWhileBuilding(t *testing.T) {
+	defer reset()
+	built := newTestAppender()
+	appenderTypes["test"] = func(options json.RawMessage) (Appender, error) {
+		AddAppender("a", EmptyAppender)
+		return built, nil
+	}
+	defer delete(appenderTypes, "test")
+
+	err := Configure(strings.NewReader(`{"appenders": {"a": {"type": "test"}}}`))
+	want := "logo: config: appenders.a: appender already exist"
+	if err == nil || err.Error() != want {
+		t.Errorf("Configure error got %v, want %q", err, want)
+	}
+	if a, _ := manager.appender("a"); a != EmptyAppender {
+		t.Errorf("Appender got %v, want %v", a, EmptyAppender)
+	}
+	if !built.Closed {
+		t.Errorf("Built appender not closed")
+	}
+}
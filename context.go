@@ -0,0 +1,180 @@
+package logo
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	propertiesKey
+)
+
+// NewContext returns a copy of ctx which carries the logger l. The logger can
+// be retrieved with FromContext, and is used by the package level Context
+// logging functions, e.g. InfoContext.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// FromContext returns the logger carried by ctx. If ctx does not carry a
+// logger, a context logger for the default logger is returned; it is shared,
+// so should not be modified.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(loggerKey).(*Logger); ok {
+		return l
+	}
+	cfg := defaultLogger.load()
+	if c, ok := contextDefault.Load().(*defaultChild); ok && c.logger.parent == defaultLogger && c.config == cfg {
+		return c.logger
+	}
+	// the default logger expects to be called from the package functions
+	c := defaultLogger.child()
+	c.callDepth = 2
+	contextDefault.Store(&defaultChild{logger: c, config: cfg})
+	return c
+}
+
+// defaultChild is a context logger for the default logger, together with the
+// default logger configuration it was created from. It is replaced when the
+// default logger, or its configuration, changes.
+type defaultChild struct {
+	logger *Logger
+	config *loggerConfig
+}
+
+// contextDefault holds the *defaultChild returned by FromContext.
+var contextDefault atomic.Value
+
+// ContextWithProperties returns a copy of ctx which carries the properties
+// props, in addition to any properties already carried by ctx. Properties in
+// props replace any existing properties with the same name.
+// The properties are added to messages logged using the Context logging
+// methods, e.g. Logger.InfoContext, where they override logger and global
+// properties with the same name. For example:
+//
+//   ctx = logo.ContextWithProperties(ctx, map[string]interface{}{"correlation-id": id})
+//   ...
+//   log.InfoContext(ctx, "Order created", "order-id", orderID)
+func ContextWithProperties(ctx context.Context, props map[string]interface{}) context.Context {
+	existing := contextProperties(ctx)
+	p := make(map[string]interface{}, len(existing)+len(props))
+	for k, v := range existing {
+		p[k] = v
+	}
+	for k, v := range props {
+		p[k] = v
+	}
+	return context.WithValue(ctx, propertiesKey, p)
+}
+
+// contextProperties returns the properties carried by ctx, which must not be
+// modified.
+func contextProperties(ctx context.Context) map[string]interface{} {
+	p, _ := ctx.Value(propertiesKey).(map[string]interface{})
+	return p
+}
+
+// contextOutput logs msg with the properties carried by ctx and the key/value
+// pairs in keyvals. It must be called directly by the exported logging method
+// or function, so that the caller's file and line are found.
+func (l *Logger) contextOutput(ctx context.Context, s Severity, msg string, keyvals []interface{}) {
+	if s < FatalLevel && l.effectiveLevel() > s {
+		return
+	}
+	file, line := fileline(3)
+	l.output(file, line, s, contextProperties(ctx), keyvals, "", msg)
+}
+
+// DebugContext logs msg with a severity of "debug", together with the
+// properties carried by ctx (see ContextWithProperties) and the key/value
+// pairs in keyvals (see Debugw). Logging only succeeds if both the logger
+// level (and manager level) are set to "debug".
+func (l *Logger) DebugContext(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.contextOutput(ctx, DebugLevel, msg, keyvals)
+}
+
+// InfoContext logs msg with a severity of "info", together with the
+// properties carried by ctx (see ContextWithProperties) and the key/value
+// pairs in keyvals (see Debugw). Logging only succeeds if both the logger
+// level (and manager level) are set to "info" or lower.
+func (l *Logger) InfoContext(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.contextOutput(ctx, InfoLevel, msg, keyvals)
+}
+
+// WarnContext logs msg with a severity of "warn", together with the
+// properties carried by ctx (see ContextWithProperties) and the key/value
+// pairs in keyvals (see Debugw). Logging only succeeds if both the logger
+// level (and manager level) are set to "warn" or lower.
+func (l *Logger) WarnContext(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.contextOutput(ctx, WarnLevel, msg, keyvals)
+}
+
+// ErrorContext logs msg with a severity of "error", together with the
+// properties carried by ctx (see ContextWithProperties) and the key/value
+// pairs in keyvals (see Debugw). Logging only succeeds if both the logger
+// level (and manager level) are set to "error" or lower.
+func (l *Logger) ErrorContext(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.contextOutput(ctx, ErrorLevel, msg, keyvals)
+}
+
+// PanicContext logs msg with a severity of "panic", together with the
+// properties carried by ctx (see ContextWithProperties) and the key/value
+// pairs in keyvals (see Debugw), and then panics with msg. Logging only
+// succeeds if both the logger level (and manager level) are set to "panic"
+// or lower.
+func (l *Logger) PanicContext(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.contextOutput(ctx, PanicLevel, msg, keyvals)
+	panic(msg)
+}
+
+// FatalContext logs msg with a severity of "fatal", together with the
+// properties carried by ctx (see ContextWithProperties) and the key/value
+// pairs in keyvals (see Debugw), and then calls Exit. Logging only succeeds
+// if both the logger level (and manager level) are set to "fatal" or lower.
+func (l *Logger) FatalContext(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.contextOutput(ctx, FatalLevel, msg, keyvals)
+	Close()
+	exit(1)
+}
+
+// DebugContext logs msg to the logger carried by ctx (see FromContext) with a
+// severity of "debug". See Logger.DebugContext.
+func DebugContext(ctx context.Context, msg string, keyvals ...interface{}) {
+	FromContext(ctx).contextOutput(ctx, DebugLevel, msg, keyvals)
+}
+
+// InfoContext logs msg to the logger carried by ctx (see FromContext) with a
+// severity of "info". See Logger.InfoContext.
+func InfoContext(ctx context.Context, msg string, keyvals ...interface{}) {
+	FromContext(ctx).contextOutput(ctx, InfoLevel, msg, keyvals)
+}
+
+// WarnContext logs msg to the logger carried by ctx (see FromContext) with a
+// severity of "warn". See Logger.WarnContext.
+func WarnContext(ctx context.Context, msg string, keyvals ...interface{}) {
+	FromContext(ctx).contextOutput(ctx, WarnLevel, msg, keyvals)
+}
+
+// ErrorContext logs msg to the logger carried by ctx (see FromContext) with a
+// severity of "error". See Logger.ErrorContext.
+func ErrorContext(ctx context.Context, msg string, keyvals ...interface{}) {
+	FromContext(ctx).contextOutput(ctx, ErrorLevel, msg, keyvals)
+}
+
+// PanicContext logs msg to the logger carried by ctx (see FromContext) with a
+// severity of "panic", and then panics with msg. See Logger.PanicContext.
+func PanicContext(ctx context.Context, msg string, keyvals ...interface{}) {
+	FromContext(ctx).contextOutput(ctx, PanicLevel, msg, keyvals)
+	panic(msg)
+}
+
+// FatalContext logs msg to the logger carried by ctx (see FromContext) with a
+// severity of "fatal", and then calls Exit. See Logger.FatalContext.
+func FatalContext(ctx context.Context, msg string, keyvals ...interface{}) {
+	FromContext(ctx).contextOutput(ctx, FatalLevel, msg, keyvals)
+	Close()
+	exit(1)
+}
@@ -0,0 +1,107 @@
+package logo
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContextLoggingAddsContextProperties(t *testing.T) {
+	defer reset()
+	appender := newTestAppender()
+	format := "%s %f %m [%p{user} %p{request} %p{order}]"
+	appender.SetFormat(format)
+	AddAppender("test", appender)
+	SetGlobalProperty("user", "global")
+	l := New("Test", "debug")
+	l.SetAppenders("test")
+	SetAppenders("test")
+
+	ctx := ContextWithProperties(context.Background(), map[string]interface{}{"request": "r1", "order": 1})
+	ctx = ContextWithProperties(ctx, map[string]interface{}{"user": "bob"})
+	lctx := NewContext(ctx, l.WithContextProperties(map[string]interface{}{"user": "logger"}))
+
+	var tests = []struct {
+		log  func()
+		want string
+	}{
+		{func() { l.DebugContext(ctx, "debug") }, "DEBUG context_test.go debug [bob r1 1]"},
+		{func() { l.InfoContext(ctx, "info", "order", 2) }, "INFO context_test.go info [bob r1 2]"},
+		{func() { l.WarnContext(context.Background(), "warn") }, "WARN context_test.go warn [global  ]"},
+		{func() { l.ErrorContext(ctx, "error") }, "ERROR context_test.go error [bob r1 1]"},
+		{func() { InfoContext(ctx, "default") }, "INFO context_test.go default [bob r1 1]"},
+		{func() { InfoContext(lctx, "from context") }, "INFO context_test.go from context [bob r1 1]"},
+		{func() { FromContext(context.Background()).Info("plain") }, "INFO context_test.go plain [global  ]"},
+		{func() { FromContext(lctx).Info("plain") }, "INFO context_test.go plain [logger  ]"},
+	}
+	for i, test := range tests {
+		appender.Reset()
+		appender.SetFormat(format)
+		test.log()
+		if len(appender.Messages) != 1 {
+			t.Errorf("%d message count got %d, want 1", i, len(appender.Messages))
+			continue
+		}
+		if got := appender.Messages[0]; got != test.want {
+			t.Errorf("%d message got %q, want %q", i, got, test.want)
+		}
+	}
+}
+
+func TestContextLoggingRespectsLevel(t *testing.T) {
+	defer reset()
+	appender := newTestAppender()
+	AddAppender("test", appender)
+	l := New("Test", "warn")
+	l.SetAppenders("test")
+	ctx := NewContext(context.Background(), l)
+
+	l.InfoContext(ctx, "filtered")
+	DebugContext(ctx, "filtered")
+	WarnContext(ctx, "logged")
+	if got, want := len(appender.Messages), 1; got != want {
+		t.Errorf("Message count got %d, want %d", got, want)
+	}
+}
+
+func TestContextLoggingPanicsAndExits(t *testing.T) {
+	defer reset()
+	var code int
+	exit = func(i int) { code = i }
+	l := New("Test", "none")
+	ctx := NewContext(context.Background(), l)
+
+	FatalContext(ctx, "fatal")
+	if code != 1 {
+		t.Errorf("Exit code got %d, want 1", code)
+	}
+	defer func() {
+		if r := recover(); r != "panic" {
+			t.Errorf("Recovered got %v, want %v", r, "panic")
+		}
+	}()
+	l.PanicContext(ctx, "panic")
+}
+
+func TestFromContextReusesDefaultContextLogger(t *testing.T) {
+	defer reset()
+	ctx := context.Background()
+	l := FromContext(ctx)
+	allocs := testing.AllocsPerRun(100, func() {
+		if FromContext(ctx) != l {
+			t.Errorf("Logger not reused")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Allocations got %v, want 0", allocs)
+	}
+
+	defaultLogger.SetContextProperty("user", "bob")
+	if got := FromContext(ctx).load().properties["user"]; got != "bob" {
+		t.Errorf("Property got %v, want bob", got)
+	}
+
+	reset()
+	if got := FromContext(ctx).parent; got != defaultLogger {
+		t.Errorf("Parent got %p, want default logger %p", got, defaultLogger)
+	}
+}
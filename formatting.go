@@ -3,15 +3,18 @@ package logo
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
-// TODO: Add formatting options e.g. alignment, customised formatting
-
 // Formatter is the interface for appender formats.
+// Format writes part of the message output to the LogMessage buffer, e.g.
+// using m.WriteString(m.LoggerName()), and can report a failure using
+// SetError.
 type Formatter interface {
 	Format(l *LogMessage)
 	Names() []string
@@ -35,26 +38,76 @@ func (f *literalFormatter) WithParameter(p string) Formatter {
 }
 
 func newDateFormatter() *dateFormatter {
-	return &dateFormatter{buf: newTmpBuffer()}
+	return &dateFormatter{buf: newTmpBuffer(), loc: time.UTC}
 }
 
+// date encodings, other than a time layout
+const (
+	dateLayout = iota
+	dateUnix
+	dateUnixMilli
+	dateEpochFraction
+)
+
+// datePresets maps the names of preset date formats, which can be used as
+// the %date parameter, to time layouts or other encodings.
+var datePresets = map[string]interface{}{
+	"ISO8601":        "2006-01-02T15:04:05.000Z07:00",
+	"RFC3339":        time.RFC3339,
+	"RFC3339Nano":    time.RFC3339Nano,
+	"RFC1123":        time.RFC1123,
+	"RFC1123Z":       time.RFC1123Z,
+	"RFC822":         time.RFC822,
+	"RFC822Z":        time.RFC822Z,
+	"ANSIC":          time.ANSIC,
+	"Kitchen":        time.Kitchen,
+	"StampMicro":     time.StampMicro,
+	"unix":           dateUnix,
+	"unixmilli":      dateUnixMilli,
+	"epoch-fraction": dateEpochFraction,
+}
+
+// timeZonePattern matches parameter suffixes which are treated as time
+// zones, e.g. "UTC", "Local" or "Europe/London".
+var timeZonePattern = regexp.MustCompile(`^[A-Za-z_]+(/[A-Za-z0-9_+\-]+)*$`)
+
 type dateFormatter struct {
-	mu  sync.Mutex
-	buf *tmpBuffer
+	mu      sync.Mutex
+	buf     *tmpBuffer
+	layout  string // "" for the standard logo format
+	kind    int
+	loc     *time.Location
+	scratch []byte
 }
 
 func (f *dateFormatter) Format(m *LogMessage) {
-	// TODO: enable finer granularity for time format
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	// format using logo standard time format:
-	f.buf.reset()
-	f.setTime(m.timestamp)
-	m.Write(f.buf.b[:f.buf.pos])
+	t := m.timestamp.In(f.loc)
+	switch {
+	case f.kind == dateUnix:
+		f.scratch = strconv.AppendInt(f.scratch[:0], t.Unix(), 10)
+	case f.kind == dateUnixMilli:
+		f.scratch = strconv.AppendInt(f.scratch[:0], t.UnixNano()/int64(time.Millisecond), 10)
+	case f.kind == dateEpochFraction:
+		f.scratch = strconv.AppendInt(f.scratch[:0], t.Unix(), 10)
+		f.buf.reset()
+		f.buf.add('.')
+		f.buf.padNDigits(t.Nanosecond()/1000, 6)
+		f.scratch = append(f.scratch, f.buf.b[:f.buf.pos]...)
+	case f.layout != "":
+		f.scratch = t.AppendFormat(f.scratch[:0], f.layout)
+	default:
+		// format using logo standard time format:
+		f.buf.reset()
+		f.setTime(t)
+		m.Write(f.buf.b[:f.buf.pos])
+		return
+	}
+	m.Write(f.scratch)
 }
 
 func (f *dateFormatter) setTime(t time.Time) {
-	t = t.UTC() // TODO: pull this out into format options
 	year, month, day := t.Date()
 	hour, minute, second := t.Clock()
 	micro := t.Nanosecond() / 1000
@@ -78,8 +131,58 @@ func (f *dateFormatter) Names() []string {
 	return []string{"date", "d"}
 }
 
+// WithParameter returns a date formatter for the parameter p, which has the
+// form "format[,zone]", or just "zone". Format is either a preset name (see
+// datePresets) or a Go time layout, e.g. "02/01/2006 15:04:05"; if it is
+// omitted, the standard logo format is used. Zone is "UTC" (the default),
+// "Local", or an IANA time zone name, e.g. "Europe/London". An unknown zone
+// name containing '/' is an error; other text after the last comma which is
+// not a known zone is part of the format, e.g. "Jan 2, Monday".
 func (f *dateFormatter) WithParameter(p string) Formatter {
-	return newDateFormatter()
+	d := newDateFormatter()
+	layout, zone := p, ""
+	if i := strings.LastIndexByte(p, ','); i >= 0 && timeZonePattern.MatchString(strings.TrimSpace(p[i+1:])) {
+		layout, zone = p[:i], strings.TrimSpace(p[i+1:])
+	} else if _, ok := datePresets[p]; !ok && timeZonePattern.MatchString(p) {
+		layout, zone = "", p
+	}
+	if zone != "" {
+		loc, err := time.LoadLocation(zone)
+		switch {
+		case err == nil:
+			d.loc = loc
+		case strings.Contains(zone, "/"):
+			return &invalidFormatter{fmt.Errorf("unknown time zone %q", zone)}
+		default:
+			layout = p
+		}
+	}
+
+	switch v := datePresets[layout].(type) {
+	case string:
+		d.layout = v
+	case int:
+		d.kind = v
+	default:
+		d.layout = layout
+	}
+	return d
+}
+
+// invalidFormatter is returned by WithParameter when the parameter is not
+// valid, causing the format to be rejected.
+type invalidFormatter struct {
+	err error
+}
+
+func (f *invalidFormatter) Format(m *LogMessage) {}
+
+func (f *invalidFormatter) Names() []string {
+	return []string{}
+}
+
+func (f *invalidFormatter) WithParameter(p string) Formatter {
+	return f
 }
 
 func newTmpBuffer() *tmpBuffer {
@@ -245,47 +348,384 @@ func (f *propertyFormatter) WithParameter(p string) Formatter {
 	return &propertyFormatter{name: p}
 }
 
-type jsonFormatter struct{}
+// jsonField is a standard field of the JSON output, e.g. "level", and the
+// path of keys at which it is written.
+type jsonField struct {
+	name string
+	path []string
+}
+
+// defaultJSONFields are the standard fields written by %JSON.
+var defaultJSONFields = []jsonField{
+	{"timestamp", []string{"service_timestamp"}},
+	{"level", []string{"level"}},
+	{"logger", []string{"logger", "name"}},
+	{"file", []string{"file"}},
+	{"line", []string{"line"}},
+	{"message", []string{"message"}},
+}
+
+// jsonFormatter writes the whole message as a JSON object. The zero value
+// uses the default fields and encodings; options are set using a parameter
+// (see WithParameter).
+type jsonFormatter struct {
+	fields     []jsonField // nil for the default fields
+	properties []string    // the path of the properties object, nil for the top level
+	omitProps  bool
+	layout     string
+	kind       int
+	loc        *time.Location
+	newline    bool
+}
 
 func (f *jsonFormatter) Format(m *LogMessage) {
-	d := make(map[string]interface{})
-	d["service_timestamp"] = m.timestamp.UTC() // TODO: pull "UTC" out into format options
-	d["level"] = severityName[m.severity]
-	d["logger"] = map[string]string{"name": m.name}
-	d["file"] = m.file
-	d["line"] = m.line
+	b, err := json.Marshal(f.object(m, false))
+	if err != nil {
+		m.err = fmt.Errorf("JSON format failed: %v", err)
+		// retry with the values which cannot be encoded replaced by strings
+		if b, err = json.Marshal(f.object(m, true)); err != nil {
+			return
+		}
+	}
 
-	for k, v := range m.properties {
-		d[k] = v
+	m.Write(b)
+	if f.newline {
+		m.WriteByte('\n')
 	}
+}
 
-	if len(m.format) > 0 {
-		d["message"] = fmt.Sprintf(m.format, m.args...)
-	} else {
-		if len(m.args) == 1 {
-			d["message"] = m.args[0]
-		} else {
-			d["message"] = m.args
+// object returns the message as a map for encoding. Standard fields take
+// precedence over properties with the same key. If safe is true, the message
+// and property values which cannot be encoded are replaced by their string
+// representations.
+func (f *jsonFormatter) object(m *LogMessage, safe bool) map[string]interface{} {
+	value := func(v interface{}) interface{} {
+		if safe {
+			if _, err := json.Marshal(v); err != nil {
+				return fmt.Sprintf("%+v", v)
+			}
 		}
+		return v
 	}
 
-	b, err := json.Marshal(d)
-	if err != nil {
-		return
+	d := make(map[string]interface{})
+	fields := f.fields
+	if fields == nil {
+		fields = defaultJSONFields
+	}
+	for _, field := range fields {
+		var v interface{}
+		switch field.name {
+		case "timestamp":
+			v = f.timestamp(m.timestamp)
+		case "level":
+			v = severityName[m.severity]
+		case "logger":
+			v = m.name
+		case "file":
+			v = m.file
+		case "line":
+			v = m.line
+		case "message":
+			if len(m.format) > 0 {
+				v = fmt.Sprintf(m.format, m.args...)
+			} else if len(m.args) == 1 {
+				v = value(m.args[0])
+			} else {
+				v = value(m.args)
+			}
+		}
+		setJSONPath(d, field.path, v)
 	}
 
-	m.Write(b)
+	if f.omitProps || len(m.properties) == 0 {
+		return d
+	}
+	props := d
+	for _, k := range f.properties {
+		p, ok := props[k].(map[string]interface{})
+		if !ok {
+			p = make(map[string]interface{}, len(m.properties))
+			props[k] = p
+		}
+		props = p
+	}
+	for k, v := range m.properties {
+		if _, ok := props[k]; !ok {
+			props[k] = value(v)
+		}
+	}
+	return d
+}
+
+// timestamp returns t in the encoding specified for the formatter.
+func (f *jsonFormatter) timestamp(t time.Time) interface{} {
+	loc := f.loc
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	switch {
+	case f.kind == dateUnix:
+		return t.Unix()
+	case f.kind == dateUnixMilli:
+		return t.UnixNano() / int64(time.Millisecond)
+	case f.kind == dateEpochFraction:
+		return json.Number(fmt.Sprintf("%d.%06d", t.Unix(), t.Nanosecond()/1000))
+	case f.layout != "":
+		return t.Format(f.layout)
+	}
+	return t
+}
+
+// setJSONPath sets the value at path in d, creating nested objects as
+// required.
+func setJSONPath(d map[string]interface{}, path []string, v interface{}) {
+	for _, k := range path[:len(path)-1] {
+		next, ok := d[k].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			d[k] = next
+		}
+		d = next
+	}
+	d[path[len(path)-1]] = v
 }
 
 func (f *jsonFormatter) Names() []string {
 	return []string{"JSON"}
 }
 
+// WithParameter returns a JSON formatter for the parameter p, which is a
+// comma separated list of options of the form key=value:
+//
+//   timestamp, level, logger, file, line, message
+//               the key for the standard field, or "-" to omit the field;
+//               dotted keys are nested, e.g. logger=log.logger
+//   properties  the key of an object holding the properties, or "-" to omit
+//               them; by default properties are added at the top level
+//   time        the timestamp encoding, a %date preset or a Go time layout
+//   zone        the time zone of the timestamp, e.g. "Local"; default "UTC"
+//   newline     "true" to append a newline to each message
 func (f *jsonFormatter) WithParameter(p string) Formatter {
-	// TODO: Consider indent option
-	return &jsonFormatter{}
+	j := &jsonFormatter{loc: time.UTC}
+	fields := make(map[string][]string, len(defaultJSONFields))
+	for _, field := range defaultJSONFields {
+		fields[field.name] = field.path
+	}
+
+	for _, opt := range strings.Split(p, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		i := strings.IndexByte(opt, '=')
+		if i < 0 {
+			return &invalidFormatter{fmt.Errorf("option %q must have the form key=value", opt)}
+		}
+		key, v := strings.TrimSpace(opt[:i]), strings.TrimSpace(opt[i+1:])
+		if _, ok := fields[key]; ok {
+			path, err := jsonPath(key, v)
+			if err != nil {
+				return &invalidFormatter{err}
+			}
+			fields[key] = path
+			continue
+		}
+		switch key {
+		case "properties":
+			if v == "-" {
+				j.omitProps = true
+				break
+			}
+			path, err := jsonPath(key, v)
+			if err != nil {
+				return &invalidFormatter{err}
+			}
+			j.properties = path
+		case "time":
+			switch t := datePresets[v].(type) {
+			case string:
+				j.layout = t
+			case int:
+				j.kind = t
+			default:
+				j.layout = v
+			}
+		case "zone":
+			loc, err := time.LoadLocation(v)
+			if err != nil {
+				return &invalidFormatter{fmt.Errorf("unknown time zone %q", v)}
+			}
+			j.loc = loc
+		case "newline":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return &invalidFormatter{fmt.Errorf("newline: invalid value %q", v)}
+			}
+			j.newline = b
+		default:
+			return &invalidFormatter{fmt.Errorf("unknown option %q", key)}
+		}
+	}
+
+	j.fields = []jsonField{}
+	for _, field := range defaultJSONFields {
+		if path := fields[field.name]; path != nil {
+			j.fields = append(j.fields, jsonField{field.name, path})
+		}
+	}
+	if err := j.checkPaths(); err != nil {
+		return &invalidFormatter{err}
+	}
+	return j
+}
+
+// jsonPath splits the dotted key v, returning nil if v is "-".
+func jsonPath(option, v string) ([]string, error) {
+	if v == "-" {
+		return nil, nil
+	}
+	path := strings.Split(v, ".")
+	for _, k := range path {
+		if k == "" {
+			return nil, fmt.Errorf("%s: invalid key %q", option, v)
+		}
+	}
+	return path, nil
+}
+
+// checkPaths returns an error if a standard field would overwrite another
+// field, or the properties object.
+func (f *jsonFormatter) checkPaths() error {
+	for i, a := range f.fields {
+		for _, b := range f.fields[i+1:] {
+			if hasPathPrefix(a.path, b.path) || hasPathPrefix(b.path, a.path) {
+				return fmt.Errorf("%s and %s keys conflict", a.name, b.name)
+			}
+		}
+		if f.properties != nil && hasPathPrefix(f.properties, a.path) {
+			return fmt.Errorf("properties and %s keys conflict", a.name)
+		}
+	}
+	return nil
+}
+
+// hasPathPrefix reports whether path begins with prefix.
+func hasPathPrefix(path, prefix []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i, k := range prefix {
+		if path[i] != k {
+			return false
+		}
+	}
+	return true
+}
+
+// paddedFormatter applies width and alignment modifiers, e.g. %-5severity,
+// to the output of another formatter. The output is padded with spaces to at
+// least min characters, aligned to the right unless left is true. If max is
+// not zero, characters are removed from the beginning of the output until
+// it is no longer than max characters.
+type paddedFormatter struct {
+	f    Formatter
+	min  int
+	max  int
+	left bool
+}
+
+func (f *paddedFormatter) Format(m *LogMessage) {
+	start := m.Len()
+	f.f.Format(m)
+	b := m.Bytes()[start:]
+	n := utf8.RuneCount(b)
+
+	if f.max > 0 && n > f.max {
+		// remove leading characters
+		cut := 0
+		for i := n - f.max; i > 0; i-- {
+			_, size := utf8.DecodeRune(b[cut:])
+			cut += size
+		}
+		copy(b, b[cut:])
+		m.Truncate(start + len(b) - cut)
+		n = f.max
+	}
+
+	if n < f.min {
+		pad := f.min - n
+		size := m.Len() - start
+		for i := 0; i < pad; i++ {
+			m.WriteByte(' ')
+		}
+		if !f.left {
+			b = m.Bytes()[start:]
+			copy(b[pad:], b[:size])
+			for i := 0; i < pad; i++ {
+				b[i] = ' '
+			}
+		}
+	}
+}
+
+func (f *paddedFormatter) Names() []string {
+	return f.f.Names()
 }
 
+func (f *paddedFormatter) WithParameter(p string) Formatter {
+	return &paddedFormatter{f: f.f.WithParameter(p), min: f.min, max: f.max, left: f.left}
+}
+
+// parseModifier parses the width and alignment modifiers at the start of s,
+// which has the form [-][min][.max], returning a paddedFormatter (without
+// its formatter) and the length of the modifiers. If there are no modifiers,
+// the paddedFormatter is nil.
+func parseModifier(s string) (*paddedFormatter, int, error) {
+	i := 0
+	f := &paddedFormatter{}
+	if i < len(s) && s[i] == '-' {
+		f.left = true
+		i++
+	}
+	j := i
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	hasMin := i > j
+	if hasMin {
+		f.min, _ = strconv.Atoi(s[j:i])
+	} else if f.left {
+		return nil, 0, fmt.Errorf("missing width")
+	}
+
+	hasMax := i < len(s) && s[i] == '.'
+	if hasMax {
+		i++
+		j = i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == j {
+			return nil, 0, fmt.Errorf("missing maximum width")
+		}
+		f.max, _ = strconv.Atoi(s[j:i])
+		if f.max == 0 {
+			return nil, 0, fmt.Errorf("maximum width must be greater than zero")
+		}
+		if f.min > f.max {
+			return nil, 0, fmt.Errorf("minimum width %d exceeds maximum width %d", f.min, f.max)
+		}
+	}
+
+	if !hasMin && !hasMax {
+		return nil, 0, nil
+	}
+	return f, i, nil
+}
+
+// formatters holds the built-in and registered formatters.
 var formatters = []Formatter{
 	newDateFormatter(),
 	&severityFormatter{},
@@ -299,7 +739,46 @@ var formatters = []Formatter{
 	&jsonFormatter{},
 }
 
+var formattersMu sync.RWMutex // guards formatters
+
+// RegisterFormatter adds a custom formatter, so that its tags can be used in
+// the format string of any appender. For example, a formatter whose Names
+// method returns []string{"hostname", "h"} can be used with the tags
+// %hostname and %h; if a tag is followed by a parameter in braces, e.g.
+// %hostname{short}, the parameter is passed to WithParameter, and the
+// formatter returned is used instead. Without a parameter, f itself is used
+// by every appender, so its Format method must be safe for concurrent use.
+// RegisterFormatter returns an error if f has no names, or if a name is
+// already used by a built-in or previously registered formatter. Formatters
+// should be registered before the format strings which use them are set.
+func RegisterFormatter(f Formatter) error {
+	names := f.Names()
+	if len(names) == 0 {
+		return fmt.Errorf("formatter has no names")
+	}
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+	for _, n := range names {
+		if n == "" || strings.ContainsAny(n, "%{}") {
+			return fmt.Errorf("invalid formatter name %q", n)
+		}
+		for _, existing := range formatters {
+			for _, t := range existing.Names() {
+				if t == n {
+					return fmt.Errorf("formatter name %q already registered", n)
+				}
+			}
+		}
+	}
+	formatters = append(formatters, f)
+	return nil
+}
+
 func extract(format string) ([]Formatter, error) {
+	formattersMu.RLock()
+	registered := formatters
+	formattersMu.RUnlock()
+
 	s := []Formatter{}
 	p := []byte{}
 	for i := 0; i < len(format); i++ {
@@ -325,39 +804,47 @@ func extract(format string) ([]Formatter, error) {
 				p = []byte{}
 			}
 
-			// now get the formatter
-			ok := false
-			for _, f := range formatters {
-				for _, t := range f.Names() {
-					if len(t) <= len(format[i:]) {
-
-						if t == format[i:i+len(t)] {
-							i = i + len(t)
-							if i < len(format) && format[i] == '{' {
-								j := strings.IndexByte(format[i:], byte('}'))
-								if j == -1 {
-									return nil, fmt.Errorf("invalid syntax - unclosed parameter brace at position %d, %s", i, format)
-								}
-								name := format[i+1 : i+j]
-								i = i + j + 1
-								f = f.WithParameter(name)
-							}
-							i--
-							s = append(s, f)
-							ok = true
-							break
-						}
-
+			// parse any width and alignment modifiers
+			pos := i - 1
+			mod, n, err := parseModifier(format[i:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid modifier at position %d, %s: %v", pos, format, err)
+			}
+			i += n
+
+			// now get the formatter with the longest matching name
+			var f Formatter
+			var tag string
+			for _, r := range registered {
+				for _, t := range r.Names() {
+					if len(t) > len(tag) && strings.HasPrefix(format[i:], t) {
+						f, tag = r, t
 					}
 				}
-				if ok {
-					break
-				}
+			}
+			if f == nil {
+				return nil, fmt.Errorf("invalid syntax at position %d, %s", pos, format)
 			}
 
-			if !ok {
-				return nil, fmt.Errorf("invalid syntax at position %d, %s", i-1, format)
+			i = i + len(tag)
+			if i < len(format) && format[i] == '{' {
+				j := strings.IndexByte(format[i:], byte('}'))
+				if j == -1 {
+					return nil, fmt.Errorf("invalid syntax - unclosed parameter brace at position %d, %s", i, format)
+				}
+				name := format[i+1 : i+j]
+				f = f.WithParameter(name)
+				if inv, ok := f.(*invalidFormatter); ok {
+					return nil, fmt.Errorf("invalid parameter at position %d, %s: %v", i, format, inv.err)
+				}
+				i = i + j + 1
+			}
+			i--
+			if mod != nil {
+				mod.f = f
+				f = mod
 			}
+			s = append(s, f)
 		}
 
 	}
@@ -2,6 +2,8 @@ package logo
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 )
@@ -9,7 +11,7 @@ import (
 func testMessage() *LogMessage {
 	t, _ := time.Parse("2006-01-02T15:04:05.999999", "2016-04-09T18:03:28.3420170")
 	msg := LogMessage{
-		severity:   info,
+		severity:   InfoLevel,
 		name:       "Logger",
 		ctx:        "{ctx: 2}",
 		args:       []interface{}{34, 56},
@@ -160,6 +162,21 @@ func TestExtractorReturnsErrorWhenInvalidSyntax(t *testing.T) {
 		{"bla%%%h blah", "invalid syntax at position 5, bla%%%h blah"},
 		{"%blah blah", "invalid syntax at position 0, %blah blah"},
 		{"blah %property{fish", "invalid syntax - unclosed parameter brace at position 14, blah %property{fish"},
+		{"%date{ISO8601,Mars/Olympus}", "invalid parameter at position 5, %date{ISO8601,Mars/Olympus}: unknown time zone \"Mars/Olympus\""},
+		{"%date{RFC3339,Europe/Londn}", "invalid parameter at position 5, %date{RFC3339,Europe/Londn}: unknown time zone \"Europe/Londn\""},
+		{"%date{Europe/Londn}", "invalid parameter at position 5, %date{Europe/Londn}: unknown time zone \"Europe/Londn\""},
+		{"%JSON{level}", "invalid parameter at position 5, %JSON{level}: option \"level\" must have the form key=value"},
+		{"%JSON{colour=red}", "invalid parameter at position 5, %JSON{colour=red}: unknown option \"colour\""},
+		{"%JSON{level=log..level}", "invalid parameter at position 5, %JSON{level=log..level}: level: invalid key \"log..level\""},
+		{"%JSON{level=log,logger=log.name}", "invalid parameter at position 5, %JSON{level=log,logger=log.name}: level and logger keys conflict"},
+		{"%JSON{properties=line}", "invalid parameter at position 5, %JSON{properties=line}: properties and line keys conflict"},
+		{"%JSON{newline=yes}", "invalid parameter at position 5, %JSON{newline=yes}: newline: invalid value \"yes\""},
+		{"%JSON{zone=Mars/Olympus}", "invalid parameter at position 5, %JSON{zone=Mars/Olympus}: unknown time zone \"Mars/Olympus\""},
+		{"%-severity", "invalid modifier at position 0, %-severity: missing width"},
+		{"[%5.severity]", "invalid modifier at position 1, [%5.severity]: missing maximum width"},
+		{"%.0logger", "invalid modifier at position 0, %.0logger: maximum width must be greater than zero"},
+		{"%20.10logger", "invalid modifier at position 0, %20.10logger: minimum width 20 exceeds maximum width 10"},
+		{"%5blah", "invalid syntax at position 0, %5blah"},
 	}
 
 	for _, test := range tests {
@@ -322,3 +339,266 @@ func TestJsonFormatterLoggerName(t *testing.T) {
 		t.Errorf("Logger name got %v, want %q", got, want)
 	}
 }
+
+type hostFormatter struct {
+	name string
+}
+
+func (f *hostFormatter) Format(m *LogMessage) {
+	m.WriteString(f.name)
+}
+
+func (f *hostFormatter) Names() []string {
+	return []string{"hostname", "sx"}
+}
+
+func (f *hostFormatter) WithParameter(p string) Formatter {
+	return &hostFormatter{name: strings.ToUpper(p)}
+}
+
+func TestRegisterFormatter(t *testing.T) {
+	n := len(formatters)
+	defer func() { formatters = formatters[:n] }()
+
+	if err := RegisterFormatter(&hostFormatter{name: "web1"}); err != nil {
+		t.Fatalf("RegisterFormatter error: %v", err)
+	}
+
+	m := &LogMessage{severity: InfoLevel}
+	var tests = []struct {
+		format string
+		want   string
+	}{
+		{"%hostname %s", "web1 INFO"},
+		{"%hostname{web2}", "WEB2"},
+		{"%sx %sy", "web1 INFOy"}, // longest name matches
+	}
+	for _, test := range tests {
+		f, err := extract(test.format)
+		if err != nil {
+			t.Errorf("extract(%q) error: %v", test.format, err)
+			continue
+		}
+		m.Reset()
+		for _, x := range f {
+			x.Format(m)
+		}
+		if got := m.String(); got != test.want {
+			t.Errorf("extract(%q) got %q, want %q", test.format, got, test.want)
+		}
+	}
+}
+
+type namedFormatter struct {
+	hostFormatter
+	names []string
+}
+
+func (f *namedFormatter) Names() []string {
+	return f.names
+}
+
+func TestRegisterFormatterReturnsErrorForInvalidNames(t *testing.T) {
+	n := len(formatters)
+	defer func() { formatters = formatters[:n] }()
+	RegisterFormatter(&namedFormatter{names: []string{"custom"}})
+
+	var tests = []struct {
+		names []string
+		want  string
+	}{
+		{nil, "formatter has no names"},
+		{[]string{"tag", ""}, `invalid formatter name ""`},
+		{[]string{"a{b"}, `invalid formatter name "a{b"`},
+		{[]string{"severity"}, `formatter name "severity" already registered`},
+		{[]string{"x", "m"}, `formatter name "m" already registered`},
+		{[]string{"custom"}, `formatter name "custom" already registered`},
+	}
+	for _, test := range tests {
+		err := RegisterFormatter(&namedFormatter{names: test.names})
+		if got := fmt.Sprint(err); got != test.want {
+			t.Errorf("RegisterFormatter(%q) error got %q, want %q", test.names, got, test.want)
+		}
+	}
+	if got := len(formatters); got != n+1 {
+		t.Errorf("Formatter count got %d, want %d", got, n+1)
+	}
+}
+
+func TestDateFormatterWithParameter(t *testing.T) {
+	var tests = []struct {
+		param string
+		want  string
+	}{
+		{"", "2016-04-09 18:03:28.342017"},
+		{"ISO8601", "2016-04-09T18:03:28.342Z"},
+		{"RFC3339Nano", "2016-04-09T18:03:28.342017Z"},
+		{"RFC1123", "Sat, 09 Apr 2016 18:03:28 UTC"},
+		{"unix", "1460225008"},
+		{"unixmilli", "1460225008342"},
+		{"epoch-fraction", "1460225008.342017"},
+		{"15:04:05.000", "18:03:28.342"},
+		{"Mon, 02 Jan 2006", "Sat, 09 Apr 2016"},
+		{"ISO8601,Europe/London", "2016-04-09T19:03:28.342+01:00"},
+		{",America/New_York", "2016-04-09 14:03:28.342017"},
+		{"15:04 MST, UTC", "18:03 UTC"},
+		{"Jan 2, Monday", "Apr 9, Saturday"},
+		{"Monday", "Saturday"},
+		{"UTC", "2016-04-09 18:03:28.342017"},
+		{"Europe/London", "2016-04-09 19:03:28.342017"},
+		{"unix,Asia/Tokyo", "1460225008"},
+	}
+
+	for _, test := range tests {
+		f := newDateFormatter().WithParameter(test.param)
+		m := testMessage()
+		f.Format(m)
+		if got := string(m.Bytes()); got != test.want {
+			t.Errorf("%%date{%s} got %q, want %q", test.param, got, test.want)
+		}
+	}
+}
+
+func TestDateFormatterDefaultLayoutDoesNotAllocate(t *testing.T) {
+	f := newDateFormatter()
+	m := testMessage()
+	allocs := testing.AllocsPerRun(100, func() {
+		m.Reset()
+		f.Format(m)
+	})
+	if allocs != 0 {
+		t.Errorf("Allocations got %v, want 0", allocs)
+	}
+}
+
+func TestExtractorWithModifiers(t *testing.T) {
+	var tests = []struct {
+		format string
+		want   string
+	}{
+		{"[%5severity]", "[ INFO]"},
+		{"[%-5severity]", "[INFO ]"},
+		{"[%2severity]", "[INFO]"},
+		{"[%.2severity]", "[FO]"},
+		{"[%-8.8logger]", "[Logger  ]"},
+		{"[%3.3logger]", "[ger]"},
+		{"[%10file:%-4line]", "[ sample.go:456 ]"},
+		{"[%.4message]", "[(56)]"},
+		{"[%12.12m]", "[Test 34 (56)]"},
+		{"[%-10property{prop2}]", "[45        ]"},
+		{"[%8date{15:04}]", "[   18:03]"},
+	}
+
+	for _, test := range tests {
+		m := testMessage()
+		formatters, err := extract(test.format)
+		if err != nil {
+			t.Errorf("extract(%q) error: %v", test.format, err)
+			continue
+		}
+		for _, f := range formatters {
+			f.Format(m)
+		}
+		if got := m.String(); got != test.want {
+			t.Errorf("%s got %q, want %q", test.format, got, test.want)
+		}
+	}
+}
+
+func TestPaddedFormatterCountsCharacters(t *testing.T) {
+	m := testMessage()
+	m.name = "żółw.ćma"
+	var tests = []struct {
+		format string
+		want   string
+	}{
+		{"[%10logger]", "[  żółw.ćma]"},
+		{"[%-10logger]", "[żółw.ćma  ]"},
+		{"[%.3logger]", "[ćma]"},
+	}
+
+	for _, test := range tests {
+		m.Reset()
+		formatters, _ := extract(test.format)
+		for _, f := range formatters {
+			f.Format(m)
+		}
+		if got := m.String(); got != test.want {
+			t.Errorf("%s got %q, want %q", test.format, got, test.want)
+		}
+	}
+}
+
+func TestJsonFormatterWithParameter(t *testing.T) {
+	var tests = []struct {
+		param string
+		want  string
+	}{
+		{"", `{"file":"sample.go","level":"INFO","line":456,"logger":{"name":"Logger"},"message":"Test 34 (56)","prop1":"value1","prop2":45,"service_timestamp":"2016-04-09T18:03:28.342017Z"}`},
+		{"timestamp=@timestamp,level=log.level,logger=log.logger,file=-,line=-,properties=labels",
+			`{"@timestamp":"2016-04-09T18:03:28.342017Z","labels":{"prop1":"value1","prop2":45},"log":{"level":"INFO","logger":"Logger"},"message":"Test 34 (56)"}`},
+		{"timestamp=ts,time=unixmilli,level=-,logger=-,file=-,line=-,properties=-", `{"message":"Test 34 (56)","ts":1460225008342}`},
+		{"timestamp=ts,time=epoch-fraction,level=-,logger=-,file=-,line=-,message=-,properties=-", `{"ts":1460225008.342017}`},
+		{"timestamp=ts, time=RFC3339, zone=America/New_York, level=-, logger=-, file=-, line=-, message=-, properties=-", `{"ts":"2016-04-09T14:03:28-04:00"}`},
+		{"level=-,file=-,line=-,message=-,timestamp=-,properties=logger", `{"logger":{"name":"Logger","prop1":"value1","prop2":45}}`},
+		{"level=-,logger=-,file=-,line=-,message=-,timestamp=-,properties=-,newline=true", "{}\n"},
+	}
+
+	for _, test := range tests {
+		f, err := extract("%JSON{" + test.param + "}")
+		if err != nil {
+			t.Errorf("%s error: %v", test.param, err)
+			continue
+		}
+		m := testMessage()
+		f[0].Format(m)
+		if got := m.String(); got != test.want {
+			t.Errorf("%s got %s, want %s", test.param, got, test.want)
+		}
+	}
+}
+
+func TestJsonFormatterStandardFieldsOverrideProperties(t *testing.T) {
+	m := testMessage()
+	m.properties = map[string]interface{}{"level": "loud", "logger": map[string]interface{}{"name": "prop"}, "region": "eu"}
+	formatter := &jsonFormatter{}
+	formatter.Format(m)
+
+	want := `{"file":"sample.go","level":"INFO","line":456,"logger":{"name":"Logger"},"message":"Test 34 (56)","region":"eu","service_timestamp":"2016-04-09T18:03:28.342017Z"}`
+	if got := m.String(); got != want {
+		t.Errorf("JSON got %s, want %s", got, want)
+	}
+	if got := m.properties["logger"].(map[string]interface{})["name"]; got != "prop" {
+		t.Errorf("Property modified, got %v, want prop", got)
+	}
+}
+
+func TestJsonFormatterFallsBackWhenMarshalFails(t *testing.T) {
+	m := testMessage()
+	m.format = ""
+	m.args = []interface{}{map[string]interface{}{"c": make(chan int)}}
+	m.properties = map[string]interface{}{"ok": 1, "bad": func() {}}
+	f, _ := extract("%JSON{timestamp=-,level=-,logger=-,file=-,line=-}")
+	m.err = nil
+	f[0].Format(m)
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(m.Bytes(), &obj); err != nil {
+		t.Fatalf("Unmarshal error: %v, %s", err, m.Bytes())
+	}
+	var tests = []struct {
+		property string
+		got      interface{}
+		want     interface{}
+	}{
+		{"ok", obj["ok"], 1.0},
+		{"bad", strings.HasPrefix(obj["bad"].(string), "0x"), true},
+		{"message", strings.HasPrefix(obj["message"].(string), "map[c:0x"), true},
+		{"error", m.err != nil && strings.HasPrefix(m.err.Error(), "JSON format failed: json: unsupported type"), true},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s got %v, want %v", test.property, test.got, test.want)
+		}
+	}
+}
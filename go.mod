@@ -0,0 +1,3 @@
+module github.com/spaceweasel/logo
+
+go 1.15
@@ -0,0 +1,445 @@
+package logo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPEncoding determines how an HTTPAppender combines the messages in a
+// batch into a request body.
+type HTTPEncoding int
+
+const (
+	// EncodingNDJSON writes each message on a separate line (newline
+	// delimited JSON). This is the default.
+	EncodingNDJSON HTTPEncoding = iota
+	// EncodingJSONArray writes the messages as the elements of a JSON array.
+	EncodingJSONArray
+)
+
+var httpEncodingNames = []string{"ndjson", "array"}
+
+func (e HTTPEncoding) String() string {
+	if e < 0 || int(e) >= len(httpEncodingNames) {
+		return fmt.Sprintf("HTTPEncoding(%d)", int(e))
+	}
+	return httpEncodingNames[e]
+}
+
+// UnmarshalText sets the encoding from its name; either "ndjson" or "array".
+// It enables the encoding to be specified in configuration files.
+func (e *HTTPEncoding) UnmarshalText(text []byte) error {
+	for i, n := range httpEncodingNames {
+		if strings.EqualFold(n, string(text)) {
+			*e = HTTPEncoding(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unrecognised encoding %q", text)
+}
+
+// HTTPConfig holds the parameters for an HTTPAppender.
+// URL is the endpoint which batches of messages are POSTed to, with the
+// additional request Headers, e.g. {"Authorization": "Bearer ..."}.
+// Encoding determines the format of the request body, which is compressed
+// if Gzip is set.
+//
+// A batch is sent when it holds BatchSize messages (default 100), or
+// BatchBytes bytes (default 1MB), or BatchLatency (default 1s) after its
+// first message was logged. Up to QueueSize messages (default 10000) can be
+// waiting to be batched; further messages are dropped.
+//
+// Requests which fail with a network error, a 5xx status or 429 (Too Many
+// Requests) are retried up to MaxRetries times (default 3, or none if
+// negative), waiting MinBackoff (default 100ms), doubling up to MaxBackoff
+// (default 30s), between attempts; a Retry-After header is honoured, up to
+// MaxBackoff.
+// Batches which cannot be sent are passed to DeadLetter, if specified.
+// Timeout limits the time taken by each request (default 10s); Client is
+// used to send requests, if specified.
+type HTTPConfig struct {
+	URL          string
+	Headers      map[string]string
+	Encoding     HTTPEncoding
+	Gzip         bool
+	BatchSize    int
+	BatchBytes   int
+	BatchLatency time.Duration
+	QueueSize    int
+	MaxRetries   int
+	MinBackoff   time.Duration
+	MaxBackoff   time.Duration
+	Timeout      time.Duration
+	Client       *http.Client
+	DeadLetter   func(messages [][]byte, err error)
+}
+
+const (
+	defaultHTTPBatchSize    = 100
+	defaultHTTPBatchBytes   = 1024 * 1024
+	defaultHTTPBatchLatency = time.Second
+	defaultHTTPQueueSize    = 10000
+	defaultHTTPMaxRetries   = 3
+	defaultHTTPTimeout      = 10 * time.Second
+	httpCloseTimeout        = 5 * time.Second
+)
+
+// HTTPWriter is an appender which sends batches of messages to an HTTP
+// endpoint. It is created by HTTPAppender.
+type HTTPWriter struct {
+	errorReporter
+	layout
+	url          string
+	headers      http.Header
+	encoding     HTTPEncoding
+	gzip         bool
+	batchSize    int
+	batchBytes   int
+	batchLatency time.Duration
+	maxRetries   int
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	client       *http.Client
+	deadLetter   func([][]byte, error)
+	dropped      uint64 // accessed atomically
+	queue        chan []byte
+	mu           sync.RWMutex
+	closed       bool
+	closeTimeout time.Duration
+	ctx          context.Context // cancelled by Close to abandon requests
+	cancel       context.CancelFunc
+	done         chan struct{}
+	body         bytes.Buffer
+}
+
+// HTTPAppender returns an appender which sends batches of formatted log
+// messages to an HTTP endpoint, as described by config. Messages are
+// batched and sent on a background goroutine, so logging calls do not wait
+// for requests.
+//
+// Each message in a batch must be a single JSON value when EncodingJSONArray
+// is used, and a single line when EncodingNDJSON is used (a trailing newline
+// is removed).
+//
+// Close sends any batched messages, then returns. Close waits for up to 5
+// seconds; after that, any request in progress is cancelled and batches which
+// have not been sent are passed to DeadLetter. Messages logged after Close
+// are dropped.
+//
+// HTTPAppender uses the format "%JSON".
+func HTTPAppender(config HTTPConfig) (*HTTPWriter, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("http: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("http: unsupported URL %q", config.URL)
+	}
+	if config.Encoding < EncodingNDJSON || config.Encoding > EncodingJSONArray {
+		return nil, fmt.Errorf("http: unknown encoding %v", config.Encoding)
+	}
+
+	a := &HTTPWriter{
+		url:          config.URL,
+		headers:      make(http.Header),
+		encoding:     config.Encoding,
+		gzip:         config.Gzip,
+		batchSize:    config.BatchSize,
+		batchBytes:   config.BatchBytes,
+		batchLatency: config.BatchLatency,
+		maxRetries:   config.MaxRetries,
+		minBackoff:   config.MinBackoff,
+		maxBackoff:   config.MaxBackoff,
+		client:       config.Client,
+		deadLetter:   config.DeadLetter,
+		closeTimeout: httpCloseTimeout,
+		done:         make(chan struct{}),
+	}
+	if a.batchSize <= 0 {
+		a.batchSize = defaultHTTPBatchSize
+	}
+	if a.batchBytes <= 0 {
+		a.batchBytes = defaultHTTPBatchBytes
+	}
+	if a.batchLatency <= 0 {
+		a.batchLatency = defaultHTTPBatchLatency
+	}
+	if a.maxRetries < 0 {
+		a.maxRetries = 0
+	} else if a.maxRetries == 0 {
+		a.maxRetries = defaultHTTPMaxRetries
+	}
+	if a.minBackoff <= 0 {
+		a.minBackoff = defaultMinBackoff
+	}
+	if a.maxBackoff <= 0 {
+		a.maxBackoff = defaultMaxBackoff
+	}
+	if a.maxBackoff < a.minBackoff {
+		a.maxBackoff = a.minBackoff
+	}
+	if a.client == nil {
+		timeout := config.Timeout
+		if timeout <= 0 {
+			timeout = defaultHTTPTimeout
+		}
+		a.client = &http.Client{Timeout: timeout}
+	}
+	size := config.QueueSize
+	if size <= 0 {
+		size = defaultHTTPQueueSize
+	}
+	a.queue = make(chan []byte, size)
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+
+	if a.encoding == EncodingJSONArray {
+		a.headers.Set("Content-Type", "application/json")
+	} else {
+		a.headers.Set("Content-Type", "application/x-ndjson")
+	}
+	if a.gzip {
+		a.headers.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range config.Headers {
+		a.headers.Set(k, v)
+	}
+
+	a.SetFormat("%JSON")
+	a.SetFilters(severityName...)
+	go a.run()
+	return a, nil
+}
+
+// Append queues the formatted message to be sent in the next batch, or drops
+// it if the queue is full.
+func (a *HTTPWriter) Append(m *LogMessage) {
+	ok, err := a.format(m)
+	if err != nil {
+		a.reportError(err)
+	}
+	if !ok {
+		return
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		atomic.AddUint64(&a.dropped, 1)
+		return
+	}
+	b := append([]byte(nil), bytes.TrimRight(m.Bytes(), "\r\n")...)
+	select {
+	case a.queue <- b:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+	}
+}
+
+// run collects messages from the queue into batches, and sends each batch
+// when it is full or its latency has expired.
+func (a *HTTPWriter) run() {
+	defer close(a.done)
+	var batch [][]byte
+	var size int
+	var expired <-chan time.Time
+	send := func() {
+		if len(batch) > 0 {
+			a.send(batch)
+		}
+		batch, size, expired = nil, 0, nil
+	}
+
+	for {
+		select {
+		case b, ok := <-a.queue:
+			if !ok {
+				send()
+				return
+			}
+			if len(batch) > 0 && size+len(b) > a.batchBytes {
+				send()
+			}
+			if len(batch) == 0 {
+				expired = time.After(a.batchLatency)
+			}
+			batch = append(batch, b)
+			size += len(b)
+			if len(batch) >= a.batchSize || size >= a.batchBytes {
+				send()
+			}
+		case <-expired:
+			send()
+		}
+	}
+}
+
+// errCloseTimeout is reported for batches which could not be sent before the
+// close timeout expired.
+var errCloseTimeout = errors.New("close timeout exceeded")
+
+// send posts the batch, retrying if the request fails with a temporary
+// error, until requests are abandoned by Close. If the batch cannot be sent,
+// the error is reported and the batch is passed to the dead letter function.
+func (a *HTTPWriter) send(batch [][]byte) {
+	if a.ctx.Err() != nil {
+		a.fail(batch, errCloseTimeout)
+		return
+	}
+	body, err := a.encode(batch)
+	if err != nil {
+		a.fail(batch, err)
+		return
+	}
+
+	for attempt := 0; ; attempt++ {
+		retry, wait, err := a.post(body)
+		if err == nil {
+			return
+		}
+		if a.ctx.Err() != nil {
+			a.fail(batch, errCloseTimeout)
+			return
+		}
+		if !retry || attempt >= a.maxRetries {
+			a.fail(batch, err)
+			return
+		}
+		if wait <= 0 {
+			wait = backoff(attempt, a.minBackoff, a.maxBackoff)
+		} else if wait > a.maxBackoff {
+			wait = a.maxBackoff
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-a.ctx.Done():
+			t.Stop()
+			a.fail(batch, errCloseTimeout)
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// encode returns the request body for the batch.
+func (a *HTTPWriter) encode(batch [][]byte) ([]byte, error) {
+	a.body.Reset()
+	var w io.Writer = &a.body
+	var zw *gzip.Writer
+	if a.gzip {
+		zw = gzip.NewWriter(&a.body)
+		w = zw
+	}
+
+	// write records the first error, after which nothing more is written
+	var err error
+	write := func(p ...byte) {
+		if err == nil {
+			_, err = w.Write(p)
+		}
+	}
+	for i, b := range batch {
+		switch {
+		case a.encoding == EncodingNDJSON:
+			write(b...)
+			write('\n')
+		case i == 0:
+			write('[')
+			write(b...)
+		default:
+			write(',')
+			write(b...)
+		}
+	}
+	if a.encoding == EncodingJSONArray {
+		write(']')
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return a.body.Bytes(), nil
+}
+
+// post sends a single request, reporting whether a failed request can be
+// retried, and how long the server asked the client to wait.
+func (a *HTTPWriter) post(body []byte) (bool, time.Duration, error) {
+	req, err := http.NewRequestWithContext(a.ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, err
+	}
+	for k, v := range a.headers {
+		req.Header[k] = v
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return true, 0, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, 0, nil
+	}
+	err = errors.New(resp.Status)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		var wait time.Duration
+		if s, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil && s >= 0 {
+			wait = time.Duration(s) * time.Second
+		}
+		return true, wait, err
+	}
+	return false, 0, err
+}
+
+func (a *HTTPWriter) fail(batch [][]byte, err error) {
+	err = fmt.Errorf("http: batch of %d messages failed: %v", len(batch), err)
+	a.reportError(err)
+	if a.deadLetter != nil {
+		a.deadLetter(batch, err)
+	}
+}
+
+// Dropped returns the number of messages discarded because the queue was full
+// or the appender was closed.
+func (a *HTTPWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Close sends any queued messages, then stops the background goroutine. If
+// the messages have not been sent within the close timeout, the request in
+// progress is cancelled and the remaining batches are not sent.
+func (a *HTTPWriter) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+
+	t := time.NewTimer(a.closeTimeout)
+	defer t.Stop()
+	select {
+	case <-a.done:
+	case <-t.C:
+		a.cancel()
+		<-a.done
+	}
+	a.cancel()
+}
@@ -0,0 +1,324 @@
+package logo
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedRequest struct {
+	header http.Header
+	body   string
+}
+
+// testEndpoint records requests, responding with the status codes in
+// statuses (and then 200).
+type testEndpoint struct {
+	mu       sync.Mutex
+	requests []recordedRequest
+	statuses []int
+}
+
+func (e *testEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	b, _ := ioutil.ReadAll(body)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requests = append(e.requests, recordedRequest{r.Header, string(b)})
+	if len(e.statuses) > 0 {
+		code := e.statuses[0]
+		e.statuses = e.statuses[1:]
+		if code == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(code)
+	}
+}
+
+func (e *testEndpoint) bodies() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var s []string
+	for _, r := range e.requests {
+		s = append(s, r.body)
+	}
+	return s
+}
+
+func appendMessages(a Appender, messages ...string) {
+	m := testMessage()
+	m.args = nil
+	for _, s := range messages {
+		m.format = s
+		a.Append(m)
+	}
+}
+
+func TestHTTPAppenderBatchesNDJSON(t *testing.T) {
+	e := &testEndpoint{}
+	s := httptest.NewServer(e)
+	defer s.Close()
+
+	a, err := HTTPAppender(HTTPConfig{
+		URL:       s.URL,
+		Headers:   map[string]string{"Authorization": "Bearer token"},
+		BatchSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("HTTPAppender error: %v", err)
+	}
+	a.SetFormat("%m%n")
+	appendMessages(a, "one", "two", "three")
+	a.Close()
+
+	want := []string{"one\ntwo\n", "three\n"}
+	if got := e.bodies(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Bodies got %q, want %q", got, want)
+	}
+	h := e.requests[0].header
+	var tests = []struct {
+		header string
+		want   string
+	}{
+		{"Authorization", "Bearer token"},
+		{"Content-Type", "application/x-ndjson"},
+		{"Content-Encoding", ""},
+	}
+	for _, test := range tests {
+		if got := h.Get(test.header); got != test.want {
+			t.Errorf("%s got %q, want %q", test.header, got, test.want)
+		}
+	}
+}
+
+func TestHTTPAppenderGzipJSONArray(t *testing.T) {
+	e := &testEndpoint{}
+	s := httptest.NewServer(e)
+	defer s.Close()
+
+	a, err := HTTPAppender(HTTPConfig{URL: s.URL, Encoding: EncodingJSONArray, Gzip: true})
+	if err != nil {
+		t.Fatalf("HTTPAppender error: %v", err)
+	}
+	a.SetFormat("%JSON{timestamp=-,file=-,line=-,logger=-,properties=-}")
+	appendMessages(a, "one", "two")
+	a.Close()
+
+	if len(e.requests) != 1 {
+		t.Fatalf("Requests got %d, want 1", len(e.requests))
+	}
+	var got []map[string]string
+	if err := json.Unmarshal([]byte(e.requests[0].body), &got); err != nil {
+		t.Fatalf("Unmarshal error: %v, %s", err, e.requests[0].body)
+	}
+	if len(got) != 2 || got[0]["message"] != "one" || got[1]["message"] != "two" {
+		t.Errorf("Messages got %v, want one and two", got)
+	}
+	if got, want := e.requests[0].header.Get("Content-Type"), "application/json"; got != want {
+		t.Errorf("Content-Type got %q, want %q", got, want)
+	}
+}
+
+func TestHTTPAppenderBatchLimits(t *testing.T) {
+	e := &testEndpoint{}
+	s := httptest.NewServer(e)
+	defer s.Close()
+
+	a, err := HTTPAppender(HTTPConfig{URL: s.URL, BatchBytes: 8, BatchLatency: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("HTTPAppender error: %v", err)
+	}
+	defer a.Close()
+	a.SetFormat("%m")
+
+	// sent when the bytes limit is reached, and then when the latency expires
+	appendMessages(a, "one", "two", "three", "four")
+	want := []string{"one\ntwo\n", "three\n", "four\n"}
+	if !waitFor(func() bool { return len(e.bodies()) == 3 }) {
+		t.Fatalf("Requests got %d, want 3", len(e.bodies()))
+	}
+	if got := e.bodies(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Bodies got %q, want %q", got, want)
+	}
+}
+
+func TestHTTPAppenderRetries(t *testing.T) {
+	defer reset()
+	var r errorRecorder
+	SetErrorHandler(r.handle)
+
+	var tests = []struct {
+		statuses []int
+		requests int
+		err      string
+		dead     int
+	}{
+		{[]int{503, 429}, 3, "", 0},
+		{[]int{500, 500, 500}, 3, "http: batch of 2 messages failed: 500 Internal Server Error", 2},
+		{[]int{400}, 1, "http: batch of 2 messages failed: 400 Bad Request", 2},
+	}
+	for _, test := range tests {
+		r = errorRecorder{}
+		e := &testEndpoint{statuses: test.statuses}
+		s := httptest.NewServer(e)
+		var dead [][]byte
+		var deadErr error
+		a, err := HTTPAppender(HTTPConfig{
+			URL:        s.URL,
+			MaxRetries: 2,
+			MinBackoff: time.Millisecond,
+			DeadLetter: func(messages [][]byte, err error) {
+				dead, deadErr = messages, err
+			},
+		})
+		if err != nil {
+			t.Fatalf("HTTPAppender error: %v", err)
+		}
+		AddAppender("http", a)
+		a.SetFormat("%m")
+		appendMessages(a, "one", "two")
+		a.Close()
+		s.Close()
+
+		if got := len(e.requests); got != test.requests {
+			t.Errorf("%v requests got %d, want %d", test.statuses, got, test.requests)
+		}
+		if got := strings.Join(r.errs, ","); got != test.err {
+			t.Errorf("%v error got %q, want %q", test.statuses, got, test.err)
+		}
+		if len(dead) != test.dead {
+			t.Errorf("%v dead letters got %d, want %d", test.statuses, len(dead), test.dead)
+		}
+		if test.dead > 0 && (string(dead[0]) != "one" || deadErr == nil || deadErr.Error() != test.err) {
+			t.Errorf("%v dead letter got %q %v, want one %q", test.statuses, dead[0], deadErr, test.err)
+		}
+	}
+}
+
+func TestHTTPAppenderCloseAbandonsRetries(t *testing.T) {
+	defer reset()
+	SetErrorHandler(DiscardErrorHandler)
+	e := &testEndpoint{statuses: []int{503, 503}}
+	s := httptest.NewServer(e)
+	defer s.Close()
+
+	var dead [][]byte
+	a, err := HTTPAppender(HTTPConfig{
+		URL:        s.URL,
+		MinBackoff: time.Hour,
+		DeadLetter: func(messages [][]byte, err error) {
+			dead = messages
+		},
+	})
+	if err != nil {
+		t.Fatalf("HTTPAppender error: %v", err)
+	}
+	a.closeTimeout = 10 * time.Millisecond
+	a.SetFormat("%m")
+	appendMessages(a, "one")
+
+	start := time.Now()
+	a.Close()
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Close took %v, want less than 5s", d)
+	}
+	if got := len(e.bodies()); got != 1 {
+		t.Errorf("Requests got %d, want 1", got)
+	}
+	if len(dead) != 1 || string(dead[0]) != "one" {
+		t.Errorf("Dead letters got %q, want [one]", dead)
+	}
+}
+
+func TestHTTPAppenderCloseCancelsRequests(t *testing.T) {
+	defer reset()
+	SetErrorHandler(DiscardErrorHandler)
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release // never respond while the appender is open
+	}))
+	defer s.Close()
+	defer close(release)
+
+	var mu sync.Mutex
+	var dead int
+	a, err := HTTPAppender(HTTPConfig{
+		URL:       s.URL,
+		BatchSize: 1,
+		Timeout:   10 * time.Second,
+		DeadLetter: func(messages [][]byte, err error) {
+			mu.Lock()
+			dead += len(messages)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("HTTPAppender error: %v", err)
+	}
+	a.closeTimeout = 100 * time.Millisecond
+	a.SetFormat("%m")
+	appendMessages(a, "one", "two", "three", "four", "five")
+
+	start := time.Now()
+	a.Close()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Close took %v, want about %v", d, a.closeTimeout)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if dead != 5 {
+		t.Errorf("Dead letters got %d, want 5", dead)
+	}
+}
+
+func TestHTTPAppenderDropsMessagesAfterClose(t *testing.T) {
+	e := &testEndpoint{}
+	s := httptest.NewServer(e)
+	defer s.Close()
+
+	a, _ := HTTPAppender(HTTPConfig{URL: s.URL})
+	a.Close()
+	appendMessages(a, "late")
+	if got, want := a.Dropped(), uint64(1); got != want {
+		t.Errorf("Dropped got %d, want %d", got, want)
+	}
+	if got := len(e.bodies()); got != 0 {
+		t.Errorf("Requests got %d, want 0", got)
+	}
+}
+
+func TestHTTPAppenderReturnsErrorWhenInvalidConfig(t *testing.T) {
+	var tests = []struct {
+		config HTTPConfig
+		want   string
+	}{
+		{HTTPConfig{}, `http: unsupported URL ""`},
+		{HTTPConfig{URL: "ftp://logs"}, `http: unsupported URL "ftp://logs"`},
+		{HTTPConfig{URL: "http://logs", Encoding: HTTPEncoding(5)}, "http: unknown encoding HTTPEncoding(5)"},
+	}
+	for _, test := range tests {
+		_, err := HTTPAppender(test.config)
+		if err == nil {
+			t.Errorf("%+v got <nil>, want %q", test.config, test.want)
+			continue
+		}
+		if got := err.Error(); got != test.want {
+			t.Errorf("%+v got %q, want %q", test.config, got, test.want)
+		}
+	}
+}
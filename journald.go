@@ -0,0 +1,244 @@
+package logo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JournaldConfig holds the parameters for a JournaldAppender.
+// SocketPath is the path of the journald native protocol socket; the default
+// is "/run/systemd/journal/socket". SyslogIdentifier is sent as the
+// SYSLOG_IDENTIFIER field, and defaults to the program name.
+type JournaldConfig struct {
+	SocketPath       string
+	SyslogIdentifier string
+}
+
+const defaultJournalSocket = "/run/systemd/journal/socket"
+
+// journalFields are the fields written by the appender, which take precedence
+// over properties with the same name.
+var journalFields = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"LOGGER":            true,
+	"SYSLOG_IDENTIFIER": true,
+}
+
+type journaldAppender struct {
+	errorReporter
+	layout
+	mu         sync.Mutex
+	path       string
+	identifier string
+	conn       net.Conn
+	buf        []byte
+	keys       []string
+	closed     bool
+}
+
+// JournaldAppender returns an appender which writes log messages to the
+// systemd journal using its native protocol, as described by config. Each
+// message is sent with the fields:
+//
+//   MESSAGE            the formatted message
+//   PRIORITY           the syslog severity (see SyslogAppender)
+//   CODE_FILE          the file where the message was logged
+//   CODE_LINE          the line where the message was logged
+//   LOGGER             the logger name, if not empty
+//   SYSLOG_IDENTIFIER  the program name
+//
+// together with each of the message properties. Property names are
+// converted to journal field names by making them upper case and replacing
+// other characters with '_', e.g. "request-id" becomes REQUEST_ID; a property
+// which would replace one of the fields above is ignored.
+//
+// JournaldAppender connects when it is created, and returns an error if the
+// socket is unavailable. Messages which are larger than the socket's maximum
+// datagram size cannot be sent, and the error is reported.
+//
+// JournaldAppender uses the format "%message".
+func JournaldAppender(config JournaldConfig) (Appender, error) {
+	a := &journaldAppender{
+		path:       config.SocketPath,
+		identifier: config.SyslogIdentifier,
+	}
+	if a.path == "" {
+		a.path = defaultJournalSocket
+	}
+	if a.identifier == "" {
+		a.identifier = filepath.Base(os.Args[0])
+	}
+
+	a.SetFormat("%message")
+	a.SetFilters(severityName...)
+	if err := a.connect(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// connect opens the journal socket. It must be called with a.mu held, or
+// before the appender is used.
+func (a *journaldAppender) connect() error {
+	c, err := dial("unixgram", a.path, nil, 0)
+	if err != nil {
+		return fmt.Errorf("journald: %v", err)
+	}
+	a.conn = c
+	return nil
+}
+
+func (a *journaldAppender) Append(m *LogMessage) {
+	ok, err := a.format(m)
+	if err != nil {
+		a.reportError(err)
+	}
+	if !ok {
+		return
+	}
+
+	// errors are reported once a.mu is released, so that an error handler
+	// can log to this appender
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return
+	}
+	a.buf = a.message(a.buf[:0], m)
+	err = a.send(a.buf)
+	a.mu.Unlock()
+	if err != nil {
+		a.reportError(err)
+	}
+}
+
+// message appends the journal entry for m to b.
+func (a *journaldAppender) message(b []byte, m *LogMessage) []byte {
+	b = appendJournalField(b, "MESSAGE", bytes.TrimRight(m.Bytes(), "\r\n"))
+	b = append(b, "PRIORITY="...)
+	b = strconv.AppendInt(b, int64(syslogLevel(m.severity)), 10)
+	b = append(b, '\n')
+	b = appendJournalField(b, "CODE_FILE", []byte(m.file))
+	b = append(b, "CODE_LINE="...)
+	b = strconv.AppendInt(b, int64(m.line), 10)
+	b = append(b, '\n')
+	if m.name != "" {
+		b = appendJournalField(b, "LOGGER", []byte(m.name))
+	}
+	b = appendJournalField(b, "SYSLOG_IDENTIFIER", []byte(a.identifier))
+
+	// sort the properties, so that the entry is deterministic
+	a.keys = a.keys[:0]
+	for k := range m.properties {
+		a.keys = append(a.keys, k)
+	}
+	sort.Strings(a.keys)
+	for _, k := range a.keys {
+		name := journalFieldName(k)
+		if name == "" || journalFields[name] {
+			continue
+		}
+		b = appendJournalField(b, name, []byte(fmt.Sprint(m.properties[k])))
+	}
+	return b
+}
+
+// appendJournalField appends a field to b. Values containing a newline are
+// written using the binary form: the name and a newline, followed by the
+// length of the value as a little-endian 64 bit integer, the value and a
+// newline.
+func appendJournalField(b []byte, name string, value []byte) []byte {
+	b = append(b, name...)
+	if bytes.IndexByte(value, '\n') < 0 {
+		b = append(b, '=')
+		b = append(b, value...)
+		return append(b, '\n')
+	}
+	var n [8]byte
+	binary.LittleEndian.PutUint64(n[:], uint64(len(value)))
+	b = append(b, '\n')
+	b = append(b, n[:]...)
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// journalFieldName converts a property name to a journal field name, which
+// may only contain upper case letters, digits and '_', must start with a
+// letter, and is at most 64 characters. It returns "" if there is no valid
+// name.
+func journalFieldName(s string) string {
+	s = strings.ToUpper(s)
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < 64; i++ {
+		c := s[i]
+		switch {
+		case c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9', c == '_':
+			if len(b) == 0 {
+				continue
+			}
+		default:
+			if len(b) == 0 {
+				continue
+			}
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+// send writes p to the journal, reconnecting and trying again if the write
+// fails. It must be called with a.mu held.
+func (a *journaldAppender) send(p []byte) error {
+	if a.conn == nil {
+		if err := a.connect(); err != nil {
+			return err
+		}
+	}
+	if err := a.write(p); err == nil {
+		return nil
+	}
+	// journald may have been restarted
+	a.conn.Close()
+	a.conn = nil
+	if err := a.connect(); err != nil {
+		return err
+	}
+	if err := a.write(p); err != nil {
+		return fmt.Errorf("journald: %v", err)
+	}
+	return nil
+}
+
+func (a *journaldAppender) write(p []byte) error {
+	a.conn.SetWriteDeadline(time.Now().Add(defaultDialTimeout))
+	_, err := a.conn.Write(p)
+	return err
+}
+
+func (a *journaldAppender) Close() {
+	a.mu.Lock()
+	a.closed = true
+	var err error
+	if a.conn != nil {
+		err = a.conn.Close()
+		a.conn = nil
+	}
+	a.mu.Unlock()
+	if err != nil {
+		a.reportError(fmt.Errorf("close failed: %v", err))
+	}
+}
@@ -0,0 +1,133 @@
+package logo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeJournalEntry decodes a native protocol datagram into its fields.
+func decodeJournalEntry(t *testing.T, b []byte) map[string]string {
+	t.Helper()
+	fields := make(map[string]string)
+	for len(b) > 0 {
+		i := bytes.IndexAny(b, "=\n")
+		if i < 0 {
+			t.Fatalf("Invalid entry %q", b)
+		}
+		name := string(b[:i])
+		if b[i] == '=' {
+			j := bytes.IndexByte(b, '\n')
+			fields[name] = string(b[i+1 : j])
+			b = b[j+1:]
+			continue
+		}
+		n := binary.LittleEndian.Uint64(b[i+1 : i+9])
+		fields[name] = string(b[i+9 : i+9+int(n)])
+		b = b[i+9+int(n)+1:]
+	}
+	return fields
+}
+
+func TestJournaldAppender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.sock")
+	c, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skipf("unixgram not supported: %v", err)
+	}
+	defer c.Close()
+
+	a, err := JournaldAppender(JournaldConfig{SocketPath: path, SyslogIdentifier: "shop"})
+	if err != nil {
+		t.Fatalf("JournaldAppender error: %v", err)
+	}
+	defer a.Close()
+
+	m := testMessage()
+	m.severity = WarnLevel
+	m.format = "Line one\nline two %d %d"
+	m.properties = map[string]interface{}{
+		"request-id": "r1",
+		"_private":   7,
+		"message":    "ignored",
+		"!!!":        "ignored",
+	}
+	a.Append(m)
+
+	b := make([]byte, 4096)
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := c.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("ReadFrom error: %v", err)
+	}
+	got := decodeJournalEntry(t, b[:n])
+
+	var tests = []struct {
+		field string
+		want  string
+	}{
+		{"MESSAGE", "Line one\nline two 34 56"},
+		{"PRIORITY", "4"},
+		{"CODE_FILE", "sample.go"},
+		{"CODE_LINE", "456"},
+		{"LOGGER", "Logger"},
+		{"SYSLOG_IDENTIFIER", "shop"},
+		{"REQUEST_ID", "r1"},
+		{"PRIVATE", "7"},
+	}
+	for _, test := range tests {
+		if got[test.field] != test.want {
+			t.Errorf("%s got %q, want %q", test.field, got[test.field], test.want)
+		}
+	}
+	if len(got) != len(tests) {
+		t.Errorf("Fields got %v, want %d fields", got, len(tests))
+	}
+}
+
+func TestJournaldMessageSendsCapturedStandardLogAsNotice(t *testing.T) {
+	a := &journaldAppender{identifier: "shop"}
+	m := testMessage()
+	m.severity = none
+	got := decodeJournalEntry(t, a.message(nil, m))
+	if got["PRIORITY"] != "5" {
+		t.Errorf("PRIORITY got %q, want %q", got["PRIORITY"], "5")
+	}
+}
+
+func TestJournalFieldName(t *testing.T) {
+	var tests = []struct {
+		name string
+		want string
+	}{
+		{"region", "REGION"},
+		{"request-id", "REQUEST_ID"},
+		{"__x.y", "X_Y"},
+		{"2fa", "FA"},
+		{"-", ""},
+		{strings.Repeat("a", 70), strings.Repeat("A", 64)},
+	}
+	for _, test := range tests {
+		if got := journalFieldName(test.name); got != test.want {
+			t.Errorf("%s got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestJournaldAppenderReturnsErrorWhenSocketUnavailable(t *testing.T) {
+	_, err := JournaldAppender(JournaldConfig{SocketPath: filepath.Join(os.TempDir(), "logo-missing.sock")})
+	if err == nil || !strings.HasPrefix(err.Error(), "journald: ") {
+		t.Errorf("Error got %v, want journald error", err)
+	}
+}
@@ -3,23 +3,29 @@ package logo
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type severity int
+// Severity is the severity level of a log message.
+type Severity int
 
+// Severity levels, in increasing order of severity.
 const (
-	debug severity = iota
-	info
-	warn
-	errorMsg
-	panicMsg
-	fatal
+	DebugLevel Severity = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	PanicLevel
+	FatalLevel
 	none
 )
 
@@ -33,22 +39,52 @@ var severityName = []string{
 	"",
 }
 
-func severityFromName(n string) severity {
+// String returns the name of the severity level, e.g. "INFO", as written by
+// the %severity format tag.
+func (s Severity) String() string {
+	return levelName(s)
+}
+
+func severityFromName(n string) Severity {
 	n = strings.ToUpper(n)
 	for i, s := range severityName {
 		if s == n {
-			return severity(i)
+			return Severity(i)
 		}
 	}
 	// TODO: Should this return an error instead?
 	return none
 }
 
+// parseSeverity is like severityFromName, but returns an error if the name
+// is not recognised. The name "none" disables logging.
+func parseSeverity(n string) (Severity, error) {
+	if strings.EqualFold(n, "none") {
+		return none, nil
+	}
+	s := severityFromName(n)
+	if s == none {
+		return none, fmt.Errorf("unrecognised level %q", n)
+	}
+	return s, nil
+}
+
+// logManager holds the configuration shared by all loggers. Configuration
+// changes are serialized by mu; values read when logging (level and
+// properties) are published atomically, so logging never takes a lock.
 type logManager struct {
-	appenders  map[string]Appender
-	level      severity
-	loggers    map[string]*Logger
-	properties map[string]interface{}
+	mu         sync.Mutex
+	appenders  map[string]Appender // guarded by mu
+	level      int32               // severity; accessed atomically
+	loggers    map[string]*Logger  // guarded by mu
+	properties atomic.Value        // map[string]interface{}; copy-on-write
+
+	configured map[string]AppenderConfig // appenders created by ApplyConfig; guarded by mu
+	configPath string                    // file last loaded by LoadConfig; guarded by mu
+
+	errMu         sync.RWMutex
+	errorHandler  ErrorHandler
+	errorHandlers map[string]ErrorHandler
 }
 
 var manager = newLogManager()
@@ -56,14 +92,34 @@ var defaultLogger = newDefaultLogger()
 
 func newLogManager() *logManager {
 	m := logManager{
-		appenders:  make(map[string]Appender),
-		loggers:    make(map[string]*Logger),
-		properties: make(map[string]interface{}),
+		appenders:     make(map[string]Appender),
+		loggers:       make(map[string]*Logger),
+		configured:    make(map[string]AppenderConfig),
+		errorHandler:  StderrErrorHandler,
+		errorHandlers: make(map[string]ErrorHandler),
 	}
+	m.properties.Store(map[string]interface{}{})
 	m.appenders["console"] = ConsoleAppender
+	ConsoleAppender.setName("console")
 	return &m
 }
 
+func (m *logManager) getLevel() Severity {
+	return Severity(atomic.LoadInt32(&m.level))
+}
+
+func (m *logManager) getProperties() map[string]interface{} {
+	return m.properties.Load().(map[string]interface{})
+}
+
+// appender returns the named appender.
+func (m *logManager) appender(name string) (Appender, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.appenders[name]
+	return a, ok
+}
+
 func newDefaultLogger() *Logger {
 	l := New("", "debug")
 	l.callDepth = 3
@@ -80,14 +136,32 @@ func newDefaultLogger() *Logger {
 //
 // Note: global properties can be overridden by contextual loggers.
 func SetGlobalProperty(name string, v interface{}) {
-	manager.properties[name] = v
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.properties.Store(withProperty(manager.getProperties(), name, v))
+}
+
+// withProperty returns a copy of props with the named property set to v.
+func withProperty(props map[string]interface{}, name string, v interface{}) map[string]interface{} {
+	p := make(map[string]interface{}, len(props)+1)
+	for k, v := range props {
+		p[k] = v
+	}
+	p[name] = v
+	return p
 }
 
 // Close closes all appenders in the log manager.
 // It is important that Close is called before exiting an application
 // to ensure that any buffered data is written.
 func Close() {
+	manager.mu.Lock()
+	appenders := make([]Appender, 0, len(manager.appenders))
 	for _, a := range manager.appenders {
+		appenders = append(appenders, a)
+	}
+	manager.mu.Unlock()
+	for _, a := range appenders {
 		a.Close()
 	}
 }
@@ -96,25 +170,188 @@ func Close() {
 // Returns an error if an appender of the same name has been
 // added previously.
 func AddAppender(name string, a Appender) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
 	if _, ok := manager.appenders[name]; ok {
 		return fmt.Errorf("appender already exist")
 	}
+	if n, ok := a.(interface {
+		setName(string)
+	}); ok {
+		n.setName(name)
+	}
 	manager.appenders[name] = a
 	return nil
 }
 
+// ErrorHandler is a function which receives errors encountered by appenders,
+// such as failures to open, write, flush or rotate files, and formatting
+// errors. Appender is the name the appender was added to the log manager with.
+// Handlers are not called while the appender is locked, so a handler can log
+// using logo; it should avoid logging to the appender which reported the
+// error, as that may fail again.
+type ErrorHandler func(appender string, err error)
+
+var errorOutput io.Writer = os.Stderr // to facilitate testing
+
+// StderrErrorHandler is an ErrorHandler which writes errors to StdErr.
+// This is the default error handler.
+func StderrErrorHandler(appender string, err error) {
+	if appender == "" {
+		fmt.Fprintf(errorOutput, "logo: %v\n", err)
+		return
+	}
+	fmt.Fprintf(errorOutput, "logo: appender %q: %v\n", appender, err)
+}
+
+// DiscardErrorHandler is an ErrorHandler which silently drops all errors.
+func DiscardErrorHandler(appender string, err error) {}
+
+// SetErrorHandler sets the error handler used for all appenders which do not
+// have their own handler (see SetAppenderErrorHandler). Passing nil restores
+// the default handler, StderrErrorHandler.
+func SetErrorHandler(h ErrorHandler) {
+	if h == nil {
+		h = StderrErrorHandler
+	}
+	manager.errMu.Lock()
+	defer manager.errMu.Unlock()
+	manager.errorHandler = h
+}
+
+// SetAppenderErrorHandler sets the error handler for the named appender,
+// overriding the handler set with SetErrorHandler. Passing nil removes the
+// appender's handler. Returns an error if the appender name is not recognised.
+func SetAppenderErrorHandler(name string, h ErrorHandler) error {
+	if _, ok := manager.appender(name); !ok {
+		return fmt.Errorf("unrecognised appender, [%s]", name)
+	}
+	manager.errMu.Lock()
+	defer manager.errMu.Unlock()
+	if h == nil {
+		delete(manager.errorHandlers, name)
+		return nil
+	}
+	manager.errorHandlers[name] = h
+	return nil
+}
+
+// handleError passes err to the error handler for the named appender.
+func handleError(appender string, err error) {
+	manager.errMu.RLock()
+	h, ok := manager.errorHandlers[appender]
+	if !ok {
+		h = manager.errorHandler
+	}
+	manager.errMu.RUnlock()
+	h(appender, err)
+}
+
 // LogMessage is the structure passed to each appender of a logger.
 type LogMessage struct {
 	bytes.Buffer
 	format     string
 	args       []interface{}
-	severity   severity
+	severity   Severity
 	name       string
 	file       string
 	line       int
 	ctx        string
 	timestamp  time.Time
 	properties map[string]interface{}
+	err        error // set by formatters which fail
+}
+
+// clone returns a copy of m, excluding its buffer, which remains valid after
+// m has been returned to the pool.
+func (m *LogMessage) clone() *LogMessage {
+	n := getMessage()
+	n.format = m.format
+	n.args = append([]interface{}(nil), m.args...)
+	n.severity = m.severity
+	n.name = m.name
+	n.file = m.file
+	n.line = m.line
+	n.ctx = m.ctx
+	n.timestamp = m.timestamp
+	n.properties = m.properties // never modified after output
+	return n
+}
+
+// Severity returns the severity level of the message.
+func (m *LogMessage) Severity() Severity {
+	return m.severity
+}
+
+// LoggerName returns the name of the logger which logged the message.
+func (m *LogMessage) LoggerName() string {
+	return m.name
+}
+
+// File returns the name of the source file from which the message was
+// logged, without its directory.
+func (m *LogMessage) File() string {
+	return m.file
+}
+
+// Line returns the line number from which the message was logged.
+func (m *LogMessage) Line() int {
+	return m.line
+}
+
+// Timestamp returns the time at which the message was logged.
+func (m *LogMessage) Timestamp() time.Time {
+	return m.timestamp
+}
+
+// FormatString returns the format string passed to a Printf style logging
+// method, e.g. Infof, or "" if the message was logged with a Println style
+// method, e.g. Info.
+func (m *LogMessage) FormatString() string {
+	return m.format
+}
+
+// Args returns the arguments passed to the logging method. The returned slice
+// must not be modified.
+func (m *LogMessage) Args() []interface{} {
+	return m.args
+}
+
+// Message returns the message text, formatted from the format string and
+// arguments as it is by the %message format tag.
+func (m *LogMessage) Message() string {
+	if len(m.format) > 0 {
+		return fmt.Sprintf(m.format, m.args...)
+	}
+	return fmt.Sprint(m.args...)
+}
+
+// Context returns the context set by the deprecated Logger.WithContext method.
+func (m *LogMessage) Context() string {
+	return m.ctx
+}
+
+// Property returns the value of the named property, and whether the property
+// is set. Properties combine global, logger, context and per call properties.
+func (m *LogMessage) Property(name string) (interface{}, bool) {
+	v, ok := m.properties[name]
+	return v, ok
+}
+
+// Properties returns a copy of the message properties.
+func (m *LogMessage) Properties() map[string]interface{} {
+	p := make(map[string]interface{}, len(m.properties))
+	for k, v := range m.properties {
+		p[k] = v
+	}
+	return p
+}
+
+// SetError records an error encountered by a Formatter. After formatting, the
+// standard appenders pass the error to the error handler (see
+// SetErrorHandler).
+func (m *LogMessage) SetError(err error) {
+	m.err = err
 }
 
 // SetManagerLevel sets the minimum severity level for logging.
@@ -124,7 +361,68 @@ type LogMessage struct {
 // The default setting is "debug", which won't restrict any logging.
 func SetManagerLevel(level string) {
 	sev := severityFromName(level)
-	manager.level = sev
+	atomic.StoreInt32(&manager.level, int32(sev))
+}
+
+// ManagerLevel returns the minimum severity level for logging, as set by
+// SetManagerLevel.
+func ManagerLevel() string {
+	return levelName(manager.getLevel())
+}
+
+// levelName returns the name of the severity level s. The name of the level
+// which disables logging is "NONE".
+func levelName(s Severity) string {
+	if s < DebugLevel || s >= none {
+		return "NONE"
+	}
+	return severityName[s]
+}
+
+// LoggerInfo describes a logger owned by the log manager.
+type LoggerInfo struct {
+	Name           string   `json:"name"`           // the default logger has the name ""
+	Level          string   `json:"level"`          // the level set for the logger, or "" if inherited
+	EffectiveLevel string   `json:"effectiveLevel"` // the level after applying the manager level
+	Appenders      []string `json:"appenders"`      // the names of the appenders used by the logger
+}
+
+// Loggers returns details of all loggers owned by the log manager, sorted by
+// name.
+func Loggers() []LoggerInfo {
+	manager.mu.Lock()
+	loggers := make([]*Logger, 0, len(manager.loggers))
+	for _, l := range manager.loggers {
+		loggers = append(loggers, l)
+	}
+	manager.mu.Unlock()
+
+	sort.Slice(loggers, func(i, j int) bool {
+		return loggers[i].name < loggers[j].name
+	})
+	result := make([]LoggerInfo, len(loggers))
+	for i, l := range loggers {
+		result[i] = l.describe()
+	}
+	return result
+}
+
+// describe returns details of the logger.
+func (l *Logger) describe() LoggerInfo {
+	var set string
+	if c := l.load(); c.levelSet {
+		set = levelName(c.level)
+	}
+	effective := l.effectiveLevel()
+	if ml := manager.getLevel(); ml > effective {
+		effective = ml
+	}
+	return LoggerInfo{
+		Name:           l.name,
+		Level:          set,
+		EffectiveLevel: levelName(effective),
+		Appenders:      append([]string{}, l.appendersConfig().appenderNames...),
+	}
 }
 
 var timenow = time.Now // to facilitate testing
@@ -161,45 +459,170 @@ func putMessage(m *LogMessage) {
 // For example, if the Warn() or Info() methods are called on a logger
 // with severity level "info", then logging will be successful, but calls
 // to Debug() will not.
+// Names are hierarchical, with levels separated by dots, e.g. "db.pool".
+// If level is "", the level is inherited from the nearest ancestor, e.g.
+// "db", which has a level set. Appenders are inherited in the same way until
+// SetAppenders is called.
 // New panics if a logger with the same name has been created previously.
 func New(name string, level string) *Logger {
-	if _, ok := manager.loggers[name]; ok {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	logger, created := manager.logger(name)
+	if !created && !logger.implicit {
 		panic(fmt.Sprintf("duplicate logger name, %q", name))
 	}
-	sev := severityFromName(level)
-	logger := &Logger{
-		level:      sev,
-		name:       name,
-		appenders:  []Appender{ConsoleAppender},
-		callDepth:  2,
-		properties: make(map[string]interface{}),
-	}
-	manager.loggers[name] = logger
+	logger.implicit = false
+	if level != "" {
+		logger.setLevel(severityFromName(level))
+	}
 	return logger
 }
 
+// logger returns the named logger, creating it and any missing ancestors if
+// necessary, and reports whether it was created. Ancestors are marked as
+// implicit. m.mu must be held.
+func (m *logManager) logger(name string) (*Logger, bool) {
+	if l, ok := m.loggers[name]; ok {
+		return l, false
+	}
+	var parent *Logger
+	if i := strings.LastIndex(name, "."); i > 0 {
+		var created bool
+		parent, created = m.logger(name[:i])
+		if created {
+			parent.implicit = true
+		}
+	}
+	l := newLogger(name, none)
+	l.parent = parent
+	l.update(func(c *loggerConfig) {
+		c.levelSet = false
+		c.appendersSet = false
+	})
+	m.loggers[name] = l
+	return l, true
+}
+
+func newLogger(name string, level Severity) *Logger {
+	l := &Logger{
+		name:      name,
+		callDepth: 2,
+	}
+	l.config.Store(&loggerConfig{
+		level:         level,
+		appenders:     []Appender{ConsoleAppender},
+		appenderNames: []string{"console"},
+		properties:    map[string]interface{}{},
+		levelSet:      true,
+		appendersSet:  true,
+	})
+	return l
+}
+
 // LoggerByName returns a pointer to a logger named n.
 // If no such named logger exists, LoggerByName creates
-// a new logger instance with default level.
+// a new logger instance, which inherits its level and appenders
+// from its ancestors (see New).
 func LoggerByName(n string) *Logger {
-	l, ok := manager.loggers[n]
-	if !ok {
-		l = New(n, "")
-	}
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	l, _ := manager.logger(n)
+	l.implicit = false
 	return l
 }
 
 // Logger is a named logger owned by the log manager. The log manager has
 // at least one default logger instance, but additional named loggers can
 // be created with the New() method.
+// Loggers are safe for concurrent use; configuration changes can be made
+// while logging.
+// A logger whose name contains a dot, e.g. "db.pool", inherits its level and
+// appenders from its parent, "db", unless they have been set. A logger whose
+// name does not contain a dot has no parent; the default logger is not the
+// parent of other loggers.
 type Logger struct {
-	level      severity
-	name       string
-	appenders  []Appender
-	context    string
-	callDepth  int
-	properties map[string]interface{}
-} //m.properties = make(map[string]interface{}, len(manager.properties))
+	name      string
+	context   string
+	callDepth int
+	parent    *Logger      // ancestor, or logger a context logger was created from
+	implicit  bool         // created as an ancestor of another logger; guarded by manager.mu
+	mu        sync.Mutex   // serializes configuration changes
+	config    atomic.Value // *loggerConfig
+}
+
+// loggerConfig is an immutable snapshot of a logger's configuration. Changes
+// are made to a copy which then replaces the snapshot, so logging calls never
+// need to take a lock.
+// Unless levelSet or appendersSet is true, the level or appenders of a logger
+// with a parent are taken from the parent when logging, so changes made to a
+// logger are followed by its descendants and context loggers.
+type loggerConfig struct {
+	level         Severity
+	appenders     []Appender
+	appenderNames []string
+	properties    map[string]interface{}
+	levelSet      bool
+	appendersSet  bool
+}
+
+func (l *Logger) load() *loggerConfig {
+	return l.config.Load().(*loggerConfig)
+}
+
+// update applies f to a copy of the logger's configuration, then publishes it.
+func (l *Logger) update(f func(c *loggerConfig)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := *l.load()
+	f(&c)
+	l.config.Store(&c)
+}
+
+// child returns a new, unmanaged logger with the same name and properties
+// as l, which inherits the level and appenders of l.
+func (l *Logger) child() *Logger {
+	c := &Logger{
+		name:      l.name,
+		context:   l.context,
+		callDepth: l.callDepth,
+		parent:    l,
+	}
+	cfg := *l.load()
+	cfg.levelSet = false
+	cfg.appendersSet = false
+	c.config.Store(&cfg)
+	return c
+}
+
+// effectiveLevel returns the level of l, or of the nearest parent with a
+// level set.
+func (l *Logger) effectiveLevel() Severity {
+	for {
+		c := l.load()
+		if c.levelSet || l.parent == nil {
+			return c.level
+		}
+		l = l.parent
+	}
+}
+
+// effectiveAppenders returns the appenders of l, or of the nearest parent
+// with appenders set.
+func (l *Logger) effectiveAppenders() []Appender {
+	return l.appendersConfig().appenders
+}
+
+// appendersConfig returns the configuration of l, or of the nearest parent
+// with appenders set.
+func (l *Logger) appendersConfig() *loggerConfig {
+	for {
+		c := l.load()
+		if c.appendersSet || l.parent == nil {
+			return c
+		}
+		l = l.parent
+	}
+}
 
 func fileline(depth int) (string, int) {
 	_, file, line, ok := runtime.Caller(depth)
@@ -215,10 +638,12 @@ func fileline(depth int) (string, int) {
 	return file, line
 }
 
-func (l *Logger) output(file string, line int, s severity, format string, args ...interface{}) {
-	if manager.level > debug && s < manager.level {
+func (l *Logger) output(file string, line int, s Severity, props map[string]interface{}, fields []interface{}, format string, args ...interface{}) {
+	if ml := manager.getLevel(); ml > DebugLevel && s < ml {
 		return
 	}
+	cfg := l.load()
+	gp := manager.getProperties()
 	msg := getMessage()
 	msg.severity = s
 	msg.name = l.name
@@ -228,17 +653,21 @@ func (l *Logger) output(file string, line int, s severity, format string, args .
 	msg.file = file
 	msg.line = line
 
-	msg.properties = make(map[string]interface{}, len(l.properties)+len(manager.properties))
-	for k, v := range manager.properties {
+	msg.properties = make(map[string]interface{}, len(cfg.properties)+len(gp)+len(props)+len(fields)/2)
+	for k, v := range gp {
+		msg.properties[k] = v
+	}
+	for k, v := range cfg.properties {
 		msg.properties[k] = v
 	}
-	for k, v := range l.properties {
+	for k, v := range props {
 		msg.properties[k] = v
 	}
+	addFields(msg.properties, fields)
 
 	msg.timestamp = timenow()
 
-	for _, a := range l.appenders {
+	for _, a := range l.effectiveAppenders() {
 		a.Append(msg)
 	}
 	putMessage(msg)
@@ -249,18 +678,71 @@ func (l *Logger) output(file string, line int, s severity, format string, args .
 // the log manager previously using the AddAppender method.
 // SetAppenders will panic if an appender name is not recognised.
 func (l *Logger) SetAppenders(names ...string) error {
-	l.appenders = []Appender{}
-	var ok bool
-	for _, n := range names {
-		var a Appender
-		if a, ok = manager.appenders[n]; !ok {
-			return fmt.Errorf("unrecognised appender, [%s]", n)
+	appenders := []Appender{}
+	var err error
+	for i, n := range names {
+		a, ok := manager.appender(n)
+		if !ok {
+			err = fmt.Errorf("unrecognised appender, [%s]", n)
+			names = names[:i]
+			break
 		}
-		l.appenders = append(l.appenders, a)
+		appenders = append(appenders, a)
+	}
+	names = append([]string{}, names...)
+	l.update(func(c *loggerConfig) {
+		c.appenders = appenders
+		c.appenderNames = names
+		c.appendersSet = true
+	})
+	return err
+}
+
+// SetLevel sets the minimum severity level for logging, e.g. "info".
+// The level "none" disables logging, and the level "" removes the logger's
+// level, so that it is inherited from its parent. Returns an error if the
+// level is not recognised.
+func (l *Logger) SetLevel(level string) error {
+	if level == "" {
+		l.update(func(c *loggerConfig) {
+			c.level = none // used if there is no parent
+			c.levelSet = false
+		})
+		return nil
 	}
+	s, err := parseSeverity(level)
+	if err != nil {
+		return err
+	}
+	l.setLevel(s)
 	return nil
 }
 
+func (l *Logger) setLevel(s Severity) {
+	l.update(func(c *loggerConfig) {
+		c.level = s
+		c.levelSet = true
+	})
+}
+
+// Level returns the minimum severity level for logging, e.g. "INFO".
+// If the logger's level has not been set, the inherited level is returned.
+func (l *Logger) Level() string {
+	return levelName(l.effectiveLevel())
+}
+
+// IsEnabled reports whether a message with the specified severity level, e.g.
+// "debug", would be logged, taking the manager level into account. It can be
+// used to avoid building expensive log arguments which would be discarded.
+func (l *Logger) IsEnabled(level string) bool {
+	s := severityFromName(level)
+	if s == none || s < l.effectiveLevel() {
+		return false
+	}
+	ml := manager.getLevel()
+	return ml <= DebugLevel || s >= ml
+}
+
 // WithContext returns a new context logger instance. The context logger
 // is identical to its parent, with the exception that the context property
 // is set and will appear in log messages (if specified in the appender
@@ -273,13 +755,12 @@ func (l *Logger) SetAppenders(names ...string) error {
 //
 // Deprecated: This method is deprecated. Use WithContextProperties instead.
 func (l *Logger) WithContext(context fmt.Stringer) *Logger {
-	return &Logger{
-		level:     l.level,
-		name:      l.name,
-		appenders: l.appenders,
-		callDepth: l.callDepth,
-		context:   context.String(),
-	}
+	c := l.child()
+	c.context = context.String()
+	c.update(func(c *loggerConfig) {
+		c.properties = nil
+	})
+	return c
 }
 
 // WithContextProperties returns a new child, context logger instance.
@@ -298,106 +779,111 @@ func (l *Logger) WithContext(context fmt.Stringer) *Logger {
 //
 // Note: context properties override global properties with the same name.
 func (l *Logger) WithContextProperties(context map[string]interface{}) *Logger {
-	return &Logger{
-		level:      l.level,
-		name:       l.name,
-		appenders:  l.appenders,
-		callDepth:  l.callDepth,
-		properties: context,
+	props := make(map[string]interface{}, len(context))
+	for k, v := range context {
+		props[k] = v
 	}
+	c := l.child()
+	c.context = ""
+	c.update(func(c *loggerConfig) {
+		c.properties = props
+	})
+	return c
 }
 
 // SetContextProperty adds or updates the named context property with the value v.
 func (l *Logger) SetContextProperty(name string, v interface{}) {
-	l.properties[name] = v
+	l.update(func(c *loggerConfig) {
+		c.properties = withProperty(c.properties, name, v)
+	})
 }
 
 // Debug logs with a severity of "debug". Logging only succeeds if both
 // the logger level (and manager level) are set to "debug".
 // Arguments are handled in the same manner as fmt.Println.
 func (l *Logger) Debug(args ...interface{}) {
-	if l.level > debug {
+	if l.effectiveLevel() > DebugLevel {
 		return
 	}
 	file, line := fileline(l.callDepth)
-	l.output(file, line, debug, "", args...)
+	l.output(file, line, DebugLevel, nil, nil, "", args...)
 }
 
 // Debugf logs with a severity of "debug". Logging only succeeds if both
 // the logger level (and manager level) are set to "debug".
 // Arguments are handled in the same manner as fmt.Printf.
 func (l *Logger) Debugf(format string, args ...interface{}) {
-	if l.level > debug {
+	if l.effectiveLevel() > DebugLevel {
 		return
 	}
 	file, line := fileline(l.callDepth)
-	l.output(file, line, debug, format, args...)
+	l.output(file, line, DebugLevel, nil, nil, format, args...)
 }
 
 // Info logs with a severity of "info". Logging only succeeds if both the
 // logger level (and manager level) are set to "info" or lower.
 // Arguments are handled in the same manner as fmt.Println.
 func (l *Logger) Info(args ...interface{}) {
-	if l.level > info {
+	if l.effectiveLevel() > InfoLevel {
 		return
 	}
 	file, line := fileline(l.callDepth)
-	l.output(file, line, info, "", args...)
+	l.output(file, line, InfoLevel, nil, nil, "", args...)
 }
 
 // Infof logs with a severity of "info". Logging only succeeds if both the
 // logger level (and manager level) are set to "info" or lower.
 // Arguments are handled in the same manner as fmt.Printf.
 func (l *Logger) Infof(format string, args ...interface{}) {
-	if l.level > info {
+	if l.effectiveLevel() > InfoLevel {
 		return
 	}
 	file, line := fileline(l.callDepth)
-	l.output(file, line, info, format, args...)
+	l.output(file, line, InfoLevel, nil, nil, format, args...)
 }
 
 // Warn logs with a severity of "warn". Logging only succeeds if both the
 // logger level (and manager level) are set to "warn" or lower.
 // Arguments are handled in the same manner as fmt.Println.
 func (l *Logger) Warn(args ...interface{}) {
-	if l.level > warn {
+	if l.effectiveLevel() > WarnLevel {
 		return
 	}
 	file, line := fileline(l.callDepth)
-	l.output(file, line, warn, "", args...)
+	l.output(file, line, WarnLevel, nil, nil, "", args...)
 }
 
 // Warnf logs with a severity of "warn". Logging only succeeds if both the
 // logger level (and manager level) are set to "warn" or lower.
 // Arguments are handled in the same manner as fmt.Printf.
 func (l *Logger) Warnf(format string, args ...interface{}) {
-	if l.level > warn {
+	if l.effectiveLevel() > WarnLevel {
 		return
 	}
 	file, line := fileline(l.callDepth)
-	l.output(file, line, warn, format, args...)
+	l.output(file, line, WarnLevel, nil, nil, format, args...)
 }
 
 // Error logs with a severity of "error". Logging only succeeds if both the
 // logger level (and manager level) are set to "error" or lower.
 // Arguments are handled in the same manner as fmt.Println.
 func (l *Logger) Error(args ...interface{}) {
-	if l.level > errorMsg {
+	if l.effectiveLevel() > ErrorLevel {
 		return
 	}
 	file, line := fileline(l.callDepth)
-	l.output(file, line, errorMsg, "", args...)
+	l.output(file, line, ErrorLevel, nil, nil, "", args...)
 }
 
 // Errorf logs with a severity of "error". Logging only succeeds if both the
 // logger level (and manager level) are set to "error" or lower.
 // Arguments are handled in the same manner as fmt.Printf.
 func (l *Logger) Errorf(format string, args ...interface{}) {
-	if l.level > errorMsg {
+	if l.effectiveLevel() > ErrorLevel {
 		return
 	}
 	file, line := fileline(l.callDepth)
-	l.output(file, line, errorMsg, format, args...)
+	l.output(file, line, ErrorLevel, nil, nil, format, args...)
 }
 
 // Panic logs with a severity of "panic", and then panics with the
@@ -405,9 +891,9 @@ func (l *Logger) Errorf(format string, args ...interface{}) {
 // logger level (and manager level) are set to "panic" or lower.
 // Arguments are handled in the same manner as fmt.Println.
 func (l *Logger) Panic(args ...interface{}) {
-	if l.level <= panicMsg {
+	if l.effectiveLevel() <= PanicLevel {
 		file, line := fileline(l.callDepth)
-		l.output(file, line, panicMsg, "", args...)
+		l.output(file, line, PanicLevel, nil, nil, "", args...)
 	}
 	panic(fmt.Sprint(args...))
 }
@@ -417,9 +903,9 @@ func (l *Logger) Panic(args ...interface{}) {
 // logger level (and manager level) are set to "panic" or lower.
 // Arguments are handled in the same manner as fmt.Printf.
 func (l *Logger) Panicf(format string, args ...interface{}) {
-	if l.level <= panicMsg {
+	if l.effectiveLevel() <= PanicLevel {
 		file, line := fileline(l.callDepth)
-		l.output(file, line, panicMsg, format, args...)
+		l.output(file, line, PanicLevel, nil, nil, format, args...)
 	}
 	panic(fmt.Sprintf(format, args...))
 }
@@ -432,7 +918,7 @@ var exit = func(i int) { os.Exit(i) } // to facilitate testing
 // Arguments are handled in the same manner as fmt.Println.
 func (l *Logger) Fatal(args ...interface{}) {
 	file, line := fileline(l.callDepth)
-	l.output(file, line, fatal, "", args...)
+	l.output(file, line, FatalLevel, nil, nil, "", args...)
 	Close()
 	exit(1)
 }
@@ -443,11 +929,112 @@ func (l *Logger) Fatal(args ...interface{}) {
 // Arguments are handled in the same manner as fmt.Printf.
 func (l *Logger) Fatalf(format string, args ...interface{}) {
 	file, line := fileline(l.callDepth)
-	l.output(file, line, fatal, format, args...)
+	l.output(file, line, FatalLevel, nil, nil, format, args...)
 	Close()
 	exit(1)
 }
 
+// Debugw logs msg with a severity of "debug", together with the key/value
+// pairs in keyvals, which are added to the message properties. Logging only
+// succeeds if both the logger level (and manager level) are set to "debug".
+// Keys must be strings, and are followed by their values, e.g.
+//
+//   log.Debugw("Order created", "order-id", id, "items", len(items))
+//
+// A value without a key is added with the key "!BADKEY" (or "!BADKEY1" and
+// so on, if there are several). Properties can be included in the output
+// using the %property{name} syntax, and are included in %JSON output. They
+// override logger and global properties with the same name.
+func (l *Logger) Debugw(msg string, keyvals ...interface{}) {
+	if l.effectiveLevel() > DebugLevel {
+		return
+	}
+	file, line := fileline(l.callDepth)
+	l.output(file, line, DebugLevel, nil, keyvals, "", msg)
+}
+
+// Infow logs msg with a severity of "info", together with the key/value
+// pairs in keyvals, which are added to the message properties. Logging only
+// succeeds if both the logger level (and manager level) are set to "info"
+// or lower. See Debugw for details of keyvals.
+func (l *Logger) Infow(msg string, keyvals ...interface{}) {
+	if l.effectiveLevel() > InfoLevel {
+		return
+	}
+	file, line := fileline(l.callDepth)
+	l.output(file, line, InfoLevel, nil, keyvals, "", msg)
+}
+
+// Warnw logs msg with a severity of "warn", together with the key/value
+// pairs in keyvals, which are added to the message properties. Logging only
+// succeeds if both the logger level (and manager level) are set to "warn"
+// or lower. See Debugw for details of keyvals.
+func (l *Logger) Warnw(msg string, keyvals ...interface{}) {
+	if l.effectiveLevel() > WarnLevel {
+		return
+	}
+	file, line := fileline(l.callDepth)
+	l.output(file, line, WarnLevel, nil, keyvals, "", msg)
+}
+
+// Errorw logs msg with a severity of "error", together with the key/value
+// pairs in keyvals, which are added to the message properties. Logging only
+// succeeds if both the logger level (and manager level) are set to "error"
+// or lower. See Debugw for details of keyvals.
+func (l *Logger) Errorw(msg string, keyvals ...interface{}) {
+	if l.effectiveLevel() > ErrorLevel {
+		return
+	}
+	file, line := fileline(l.callDepth)
+	l.output(file, line, ErrorLevel, nil, keyvals, "", msg)
+}
+
+// Panicw logs msg with a severity of "panic", together with the key/value
+// pairs in keyvals, and then panics with msg. Logging only succeeds if both
+// the logger level (and manager level) are set to "panic" or lower.
+// See Debugw for details of keyvals.
+func (l *Logger) Panicw(msg string, keyvals ...interface{}) {
+	if l.effectiveLevel() <= PanicLevel {
+		file, line := fileline(l.callDepth)
+		l.output(file, line, PanicLevel, nil, keyvals, "", msg)
+	}
+	panic(msg)
+}
+
+// Fatalw logs msg with a severity of "fatal", together with the key/value
+// pairs in keyvals, and then calls Exit. Logging only succeeds if both the
+// logger level (and manager level) are set to "fatal" or lower.
+// See Debugw for details of keyvals.
+func (l *Logger) Fatalw(msg string, keyvals ...interface{}) {
+	file, line := fileline(l.callDepth)
+	l.output(file, line, FatalLevel, nil, keyvals, "", msg)
+	Close()
+	exit(1)
+}
+
+// badKey is the key given to values in keyvals which have no key. Second and
+// subsequent values are numbered, e.g. "!BADKEY1".
+const badKey = "!BADKEY"
+
+// addFields adds the key/value pairs in keyvals to props.
+func addFields(props map[string]interface{}, keyvals []interface{}) {
+	bad := 0
+	for i := 0; i < len(keyvals); i++ {
+		k, ok := keyvals[i].(string)
+		if !ok || i == len(keyvals)-1 {
+			if bad == 0 {
+				props[badKey] = keyvals[i]
+			} else {
+				props[badKey+strconv.Itoa(bad)] = keyvals[i]
+			}
+			bad++
+			continue
+		}
+		i++
+		props[k] = keyvals[i]
+	}
+}
+
 // SetAppenders specifies one or more appenders for the default logger.
 // Appenders are specified by their string name, and must have been added to
 // the log manager previously using the AddAppender method.
@@ -456,6 +1043,12 @@ func SetAppenders(names ...string) {
 	defaultLogger.SetAppenders(names...)
 }
 
+// IsEnabled reports whether a message with the specified severity level, e.g.
+// "debug", would be logged by the default logger.
+func IsEnabled(level string) bool {
+	return defaultLogger.IsEnabled(level)
+}
+
 // Debugf logs to the default logger with a severity of "debug".
 // Logging only succeeds if the manager level is set to "debug".
 // Arguments are handled in the same manner as fmt.Printf.
@@ -544,11 +1137,55 @@ func Fatal(args ...interface{}) {
 	defaultLogger.Fatal(args...)
 }
 
+// Debugw logs msg to the default logger with a severity of "debug",
+// together with the key/value pairs in keyvals (see Logger.Debugw).
+// Logging only succeeds if the manager level is set to "debug".
+func Debugw(msg string, keyvals ...interface{}) {
+	defaultLogger.Debugw(msg, keyvals...)
+}
+
+// Infow logs msg to the default logger with a severity of "info",
+// together with the key/value pairs in keyvals (see Logger.Debugw).
+// Logging only succeeds if the manager level is set to "info" or lower.
+func Infow(msg string, keyvals ...interface{}) {
+	defaultLogger.Infow(msg, keyvals...)
+}
+
+// Warnw logs msg to the default logger with a severity of "warn",
+// together with the key/value pairs in keyvals (see Logger.Debugw).
+// Logging only succeeds if the manager level is set to "warn" or lower.
+func Warnw(msg string, keyvals ...interface{}) {
+	defaultLogger.Warnw(msg, keyvals...)
+}
+
+// Errorw logs msg to the default logger with a severity of "error",
+// together with the key/value pairs in keyvals (see Logger.Debugw).
+// Logging only succeeds if the manager level is set to "error" or lower.
+func Errorw(msg string, keyvals ...interface{}) {
+	defaultLogger.Errorw(msg, keyvals...)
+}
+
+// Panicw logs msg to the default logger with a severity of "panic",
+// together with the key/value pairs in keyvals (see Logger.Debugw), and
+// then panics with msg. Logging only succeeds if the manager level is set
+// to "panic" or lower.
+func Panicw(msg string, keyvals ...interface{}) {
+	defaultLogger.Panicw(msg, keyvals...)
+}
+
+// Fatalw logs msg to the default logger with a severity of "fatal",
+// together with the key/value pairs in keyvals (see Logger.Debugw), and
+// then calls Exit. Logging only succeeds if the manager level is set to
+// "fatal" or lower.
+func Fatalw(msg string, keyvals ...interface{}) {
+	defaultLogger.Fatalw(msg, keyvals...)
+}
+
 // CaptureStandardLog hooks into the standard go log package and redirects
 // the output to appenders.
 func CaptureStandardLog(appenders ...string) {
 	b := bridge{
-		Logger: Logger{level: none},
+		Logger: newLogger("", none),
 	}
 	b.SetAppenders(appenders...)
 
@@ -557,7 +1194,7 @@ func CaptureStandardLog(appenders ...string) {
 }
 
 type bridge struct {
-	Logger
+	*Logger
 }
 
 func (l bridge) Write(b []byte) (n int, err error) {
@@ -578,7 +1215,7 @@ func (l bridge) Write(b []byte) (n int, err error) {
 		}
 	}
 	msg = strings.TrimSpace(msg)
-	l.output(file, line, l.level, msg)
+	l.output(file, line, l.load().level, nil, nil, msg)
 
 	return len(b), nil
 }
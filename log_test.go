@@ -1,9 +1,13 @@
 package logo
 
 import (
+	"bytes"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -16,7 +20,7 @@ func TestLoggerOutputSetsMessageLine(t *testing.T) {
 	l := New("Test", "debug")
 	l.SetAppenders("test")
 
-	want := 20 // the next line
+	want := 24 // the next line
 	l.Debug("A test message")
 
 	messages := appender.logMessages
@@ -39,7 +43,7 @@ func TestDefaultLoggerOutputSetsMessageLine(t *testing.T) {
 	AddAppender("test", appender)
 	SetAppenders("test")
 
-	want := 43 // the next line
+	want := 47 // the next line
 	Debug("A test message")
 
 	messages := appender.logMessages
@@ -65,7 +69,7 @@ func TestContextLoggerOutputSetsMessageLine(t *testing.T) {
 
 	cl := l.WithContext(logContext{correlationID: 45})
 
-	want := 69 // the next line
+	want := 73 // the next line
 	cl.Debug("A test message")
 
 	messages := appender.logMessages
@@ -136,10 +140,10 @@ func TestLoggerNewPanicsWhenDuplicateName(t *testing.T) {
 }
 
 func TestNewLoggerSetsLoggerSeverityLevel(t *testing.T) {
-	want := info
+	want := InfoLevel
 	defer reset()
 	logger := New("Test", "INFO")
-	got := logger.level
+	got := logger.load().level
 
 	if got != want {
 		t.Errorf("Severity Level got %v, want %v", got, want)
@@ -147,11 +151,11 @@ func TestNewLoggerSetsLoggerSeverityLevel(t *testing.T) {
 }
 
 func TestNewLoggerSetsLoggerSeverityLevelRegardlessOfCase(t *testing.T) {
-	want := info
+	want := InfoLevel
 	defer reset()
 
 	logger := New("Test", "info")
-	got := logger.level
+	got := logger.load().level
 
 	if got != want {
 		t.Errorf("Severity Level got %v, want %v", got, want)
@@ -162,7 +166,7 @@ func TestNewLoggerSetsLoggerSeverityLevelToNoneIfNotRecognised(t *testing.T) {
 	want := none
 	defer reset()
 	logger := New("Test", "unknown")
-	got := logger.level
+	got := logger.load().level
 
 	if got != want {
 		t.Errorf("Severity Level got %v, want %v", got, want)
@@ -170,8 +174,8 @@ func TestNewLoggerSetsLoggerSeverityLevelToNoneIfNotRecognised(t *testing.T) {
 }
 
 func TestInitialUseOfManagerReturnsLogManagerWithLevelDebug(t *testing.T) {
-	want := debug
-	got := manager.level
+	want := DebugLevel
+	got := manager.getLevel()
 
 	if got != want {
 		t.Errorf("Level got %v, want %v", got, want)
@@ -187,7 +191,7 @@ func TestInitialUseOfManagerReturnsLogManagerWithInitializedAppendersMap(t *test
 }
 
 func TestInitialUseOfManagerReturnsLogManagerWithConsoleAppender(t *testing.T) {
-	want := reflect.TypeOf(&consoleAppender{})
+	want := reflect.TypeOf(&ConsoleWriter{})
 	appenders := manager.appenders
 	a, _ := appenders["console"]
 	got := reflect.TypeOf(a)
@@ -198,7 +202,7 @@ func TestInitialUseOfManagerReturnsLogManagerWithConsoleAppender(t *testing.T) {
 }
 
 func TestInitialUseOfDefaultLoggerHasSeverityLevelDebug(t *testing.T) {
-	want := debug
+	want := DebugLevel
 	dl := defaultLogger
 
 	if dl == nil {
@@ -206,7 +210,7 @@ func TestInitialUseOfDefaultLoggerHasSeverityLevelDebug(t *testing.T) {
 		return
 	}
 
-	got := dl.level
+	got := dl.load().level
 	if got != want {
 		t.Errorf("Level got %v, want %v", got, want)
 	}
@@ -281,10 +285,10 @@ func TestAddAppenderUpdatesAppenderWithSameName(t *testing.T) {
 }
 
 func TestNewLoggerAddsConsoleAppender(t *testing.T) {
-	want := reflect.TypeOf(&consoleAppender{})
+	want := reflect.TypeOf(&ConsoleWriter{})
 	defer reset()
 	l := New("Test", "debug")
-	appenders := l.appenders
+	appenders := l.load().appenders
 	if len(appenders) != 1 {
 		t.Errorf("Appenders count got %d, want 1", len(appenders))
 		return
@@ -303,7 +307,7 @@ func TestLoggerSetAppendersOverwritesExisting(t *testing.T) {
 	l := New("Test", "debug")
 	l.SetAppenders("TestAppender")
 
-	appenders := l.appenders
+	appenders := l.load().appenders
 	if len(appenders) != 1 {
 		t.Errorf("Appenders count got %d, want 1", len(appenders))
 		return
@@ -316,13 +320,13 @@ func TestLoggerSetAppendersOverwritesExisting(t *testing.T) {
 }
 
 func TestLoggerSetAppendersAcceptsMultipleAppenders(t *testing.T) {
-	want := "*logo.emptyAppender-*logo.consoleAppender"
+	want := "*logo.emptyAppender-*logo.ConsoleWriter"
 	defer reset()
 	AddAppender("TestAppender", EmptyAppender)
 	l := New("Test", "debug")
 	l.SetAppenders("TestAppender", "console")
 
-	appenders := l.appenders
+	appenders := l.load().appenders
 	if len(appenders) != 2 {
 		t.Errorf("Appenders count got %d, want 1", len(appenders))
 		return
@@ -404,7 +408,7 @@ func TestLoggerDebugfSendsPopulatedMsgToAppender(t *testing.T) {
 			}
 			return 0
 		}, 56},
-		{"severity", func(m *LogMessage) interface{} { return m.severity }, debug},
+		{"severity", func(m *LogMessage) interface{} { return m.severity }, DebugLevel},
 		{"name", func(m *LogMessage) interface{} { return m.name }, "Test"},
 		{"file", func(m *LogMessage) interface{} { return m.file }, "log_test.go"},
 		{"ctx", func(m *LogMessage) interface{} { return m.ctx }, ""},
@@ -450,7 +454,7 @@ func TestDefaultLoggerDebugfSendsPopulatedMsgToAppender(t *testing.T) {
 			}
 			return 0
 		}, 56},
-		{"severity", func(m *LogMessage) interface{} { return m.severity }, debug},
+		{"severity", func(m *LogMessage) interface{} { return m.severity }, DebugLevel},
 		{"name", func(m *LogMessage) interface{} { return m.name }, ""},
 		{"file", func(m *LogMessage) interface{} { return m.file }, "log_test.go"},
 		{"ctx", func(m *LogMessage) interface{} { return m.ctx }, ""},
@@ -491,7 +495,7 @@ func TestLoggerSendsMsgToEachAppender(t *testing.T) {
 			}
 			return 0
 		}, 56},
-		{"severity", func(m *LogMessage) interface{} { return m.severity }, debug},
+		{"severity", func(m *LogMessage) interface{} { return m.severity }, DebugLevel},
 		{"name", func(m *LogMessage) interface{} { return m.name }, "Test"},
 		{"file", func(m *LogMessage) interface{} { return m.file }, "log_test.go"},
 	}
@@ -1180,3 +1184,417 @@ func reset() {
 	defaultLogger = newDefaultLogger()
 	timenow = time.Now
 }
+
+type errorRecorder struct {
+	appenders []string
+	errs      []string
+}
+
+func (r *errorRecorder) handle(appender string, err error) {
+	r.appenders = append(r.appenders, appender)
+	r.errs = append(r.errs, err.Error())
+}
+
+func TestErrorHandlerReceivesAppenderErrors(t *testing.T) {
+	defer reset()
+	var r errorRecorder
+	SetErrorHandler(r.handle)
+
+	appender := newTestAppender()
+	appender.SetFormat("%JSON")
+	AddAppender("test", appender)
+	l := New("Test", "debug")
+	l.SetAppenders("test")
+	l.Debug(make(chan int))
+
+	if len(r.errs) != 1 {
+		t.Fatalf("Error count got %d, want 1", len(r.errs))
+	}
+	if got, want := r.appenders[0], "test"; got != want {
+		t.Errorf("Appender got %q, want %q", got, want)
+	}
+	if got, want := r.errs[0], "JSON format failed: "; !strings.HasPrefix(got, want) {
+		t.Errorf("Error got %q, want prefix %q", got, want)
+	}
+}
+
+func TestAppenderErrorHandlerOverridesErrorHandler(t *testing.T) {
+	defer reset()
+	var global, local errorRecorder
+	SetErrorHandler(global.handle)
+	AddAppender("a", newTestAppender())
+	AddAppender("b", newTestAppender())
+	if err := SetAppenderErrorHandler("a", local.handle); err != nil {
+		t.Fatalf("SetAppenderErrorHandler error: %v", err)
+	}
+
+	handleError("a", fmt.Errorf("first"))
+	handleError("b", fmt.Errorf("second"))
+	SetAppenderErrorHandler("a", nil)
+	handleError("a", fmt.Errorf("third"))
+
+	if got, want := strings.Join(local.errs, ","), "first"; got != want {
+		t.Errorf("Appender handler errors got %q, want %q", got, want)
+	}
+	if got, want := strings.Join(global.errs, ","), "second,third"; got != want {
+		t.Errorf("Global handler errors got %q, want %q", got, want)
+	}
+}
+
+func TestSetAppenderErrorHandlerReturnsErrorWhenUnrecognisedAppender(t *testing.T) {
+	want := "unrecognised appender, [missing]"
+	defer reset()
+
+	err := SetAppenderErrorHandler("missing", DiscardErrorHandler)
+	if err == nil {
+		t.Fatalf("Error <nil>, want %q", want)
+	}
+	if got := err.Error(); got != want {
+		t.Errorf("Error got %q, want %q", got, want)
+	}
+}
+
+func TestDefaultErrorHandlerWritesToStderr(t *testing.T) {
+	want := "logo: appender \"test\": broken\nlogo: broken\n"
+	defer reset()
+	var b bytes.Buffer
+	errorOutput = &b
+	defer func() { errorOutput = os.Stderr }()
+
+	handleError("test", fmt.Errorf("broken"))
+	SetErrorHandler(DiscardErrorHandler)
+	handleError("test", fmt.Errorf("discarded"))
+	SetErrorHandler(nil)
+	handleError("", fmt.Errorf("broken"))
+
+	got := b.String()
+	if got != want {
+		t.Errorf("Error output got %q, want %q", got, want)
+	}
+}
+
+func TestRollingFileAppenderReportsRotateError(t *testing.T) {
+	want := "rotate failed: "
+	now := time.Now()
+	timenow = func() time.Time { return now }
+	defer reset()
+	var r errorRecorder
+	SetErrorHandler(r.handle)
+
+	dir := t.TempDir()
+	a, err := RollingFileAppender(RollingFileConfig{
+		Filename:     filepath.Join(dir, "logs", "test.log"),
+		RollInterval: RollHourly,
+	})
+	if err == nil {
+		t.Fatalf("RollingFileAppender error <nil>, want error for missing directory")
+	}
+
+	os.Mkdir(filepath.Join(dir, "logs"), 0755)
+	a, err = RollingFileAppender(RollingFileConfig{
+		Filename:     filepath.Join(dir, "logs", "test.log"),
+		RollInterval: RollHourly,
+	})
+	if err != nil {
+		t.Fatalf("RollingFileAppender error: %v", err)
+	}
+	defer a.Close()
+	AddAppender("file", a)
+	os.RemoveAll(filepath.Join(dir, "logs"))
+
+	now = now.Add(time.Hour)
+	a.Append(testMessage())
+
+	if len(r.errs) != 1 {
+		t.Fatalf("Error count got %d, want 1", len(r.errs))
+	}
+	if got := r.appenders[0]; got != "file" {
+		t.Errorf("Appender got %q, want %q", got, "file")
+	}
+	if got := r.errs[0]; !strings.HasPrefix(got, want) {
+		t.Errorf("Error got %q, want prefix %q", got, want)
+	}
+}
+
+func TestLoggerSetLevel(t *testing.T) {
+	defer reset()
+	appender := newTestAppender()
+	AddAppender("test", appender)
+	l := New("Test", "info")
+	l.SetAppenders("test")
+	clog := l.WithContextProperties(map[string]interface{}{"user": "x"})
+
+	if err := l.SetLevel("debug"); err != nil {
+		t.Fatalf("SetLevel error: %v", err)
+	}
+	clog.Debug("message")
+	if got, want := len(appender.Messages), 1; got != want {
+		t.Errorf("Message count got %d, want %d", got, want)
+	}
+
+	var tests = []struct {
+		level string
+		want  string
+		err   string
+	}{
+		{"warn", "WARN", ""},
+		{"ERROR", "ERROR", ""},
+		{"none", "NONE", ""},
+		{"loud", "NONE", `unrecognised level "loud"`},
+	}
+	for _, test := range tests {
+		err := l.SetLevel(test.level)
+		if got := fmt.Sprint(err); test.err != "" && got != test.err {
+			t.Errorf("SetLevel(%q) error got %v, want %v", test.level, got, test.err)
+		}
+		if got := clog.Level(); got != test.want {
+			t.Errorf("SetLevel(%q) level got %v, want %v", test.level, got, test.want)
+		}
+	}
+}
+
+func TestLoggerIsEnabled(t *testing.T) {
+	defer reset()
+	l := New("Test", "info")
+
+	var tests = []struct {
+		managerLevel string
+		level        string
+		want         bool
+	}{
+		{"debug", "debug", false},
+		{"debug", "info", true},
+		{"debug", "fatal", true},
+		{"debug", "loud", false},
+		{"debug", "none", false},
+		{"warn", "info", false},
+		{"warn", "warn", true},
+		{"none", "fatal", false},
+	}
+	for _, test := range tests {
+		SetManagerLevel(test.managerLevel)
+		if got := l.IsEnabled(test.level); got != test.want {
+			t.Errorf("IsEnabled(%q) with manager level %q got %v, want %v", test.level, test.managerLevel, got, test.want)
+		}
+	}
+
+	SetManagerLevel("debug")
+	if got := IsEnabled("debug"); got != true {
+		t.Errorf("Default logger IsEnabled(debug) got %v, want true", got)
+	}
+}
+
+func TestLoggers(t *testing.T) {
+	defer reset()
+	New("db", "debug")
+	New("api", "error")
+	SetManagerLevel("info")
+
+	want := []LoggerInfo{
+		{Name: "", Level: "DEBUG", EffectiveLevel: "INFO", Appenders: []string{"console"}},
+		{Name: "api", Level: "ERROR", EffectiveLevel: "ERROR", Appenders: []string{"console"}},
+		{Name: "db", Level: "DEBUG", EffectiveLevel: "INFO", Appenders: []string{"console"}},
+	}
+	if got := Loggers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Loggers got %v, want %v", got, want)
+	}
+	if got, want := ManagerLevel(), "INFO"; got != want {
+		t.Errorf("ManagerLevel got %v, want %v", got, want)
+	}
+}
+
+func TestHierarchicalLoggersInherit(t *testing.T) {
+	defer reset()
+	appender := newTestAppender()
+	AddAppender("test", appender)
+	pool := LoggerByName("db.pool")
+	migrations := New("db.migrations", "")
+	db := New("db", "warn") // created implicitly by LoggerByName
+	db.SetAppenders("test")
+	cache := New("cache", "")
+
+	pool.Info("filtered")
+	pool.Warn("inherited")
+	db.SetLevel("debug")
+	migrations.Debug("changed")
+	migrations.SetLevel("error")
+	migrations.Warn("overridden")
+
+	var tests = []struct {
+		property string
+		got      interface{}
+		want     interface{}
+	}{
+		{"messages", len(appender.Messages), 2},
+		{"pool level", pool.Level(), "DEBUG"},
+		{"migrations level", migrations.Level(), "ERROR"},
+		{"cache level", cache.Level(), "NONE"},
+		{"cache appenders", cache.effectiveAppenders()[0], Appender(ConsoleAppender)},
+		{"implicit parent", LoggerByName("a.b").parent, LoggerByName("a")},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s got %v, want %v", test.property, test.got, test.want)
+		}
+	}
+
+	migrations.SetLevel("")
+	if got, want := migrations.Level(), "DEBUG"; got != want {
+		t.Errorf("Inherited level got %v, want %v", got, want)
+	}
+	want := []LoggerInfo{
+		{Name: "db.migrations", Level: "", EffectiveLevel: "DEBUG", Appenders: []string{"test"}},
+	}
+	if got := Loggers()[5:6]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Loggers got %v, want %v", got, want)
+	}
+}
+
+func TestNewPanicsForDuplicateHierarchicalName(t *testing.T) {
+	defer reset()
+	LoggerByName("db.pool")
+	New("db", "info")
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("New did not panic")
+		}
+	}()
+	New("db.pool", "info")
+}
+
+func TestStructuredLoggingAddsFields(t *testing.T) {
+	defer reset()
+	appender := newTestAppender()
+	appender.SetFormat("%s %m [%p{user} %p{order} %p{!BADKEY}]")
+	AddAppender("test", appender)
+	SetGlobalProperty("user", "global")
+	l := New("Test", "debug")
+	l.SetAppenders("test")
+	SetAppenders("test")
+
+	var tests = []struct {
+		log  func()
+		want string
+	}{
+		{func() { l.Debugw("created", "order", 12) }, "DEBUG created [global 12 ]"},
+		{func() { l.Infow("created", "user", "bob", "order", 12) }, "INFO created [bob 12 ]"},
+		{func() { l.Warnw("created %d", "order") }, "WARN created %d [global  order]"},
+		{func() { l.Errorw("created", 12, "x") }, "ERROR created [global  12]"},
+		{func() { Infow("default", "order", 1) }, "INFO default [global 1 ]"},
+	}
+	for i, test := range tests {
+		appender.Reset()
+		appender.SetFormat("%s %m [%p{user} %p{order} %p{!BADKEY}]")
+		test.log()
+		if len(appender.Messages) != 1 {
+			t.Errorf("%d message count got %d, want 1", i, len(appender.Messages))
+			continue
+		}
+		if got := appender.Messages[0]; got != test.want {
+			t.Errorf("%d message got %q, want %q", i, got, test.want)
+		}
+	}
+
+	if got, want := len(appender.logMessages[0].properties), 2; got != want {
+		t.Errorf("Property count got %d, want %d", got, want)
+	}
+	l.SetLevel("info")
+	appender.Reset()
+	l.Debugw("filtered", "order", 1)
+	if got := len(appender.Messages); got != 0 {
+		t.Errorf("Message count got %d, want 0", got)
+	}
+}
+
+func TestStructuredLoggingPanicsAndExits(t *testing.T) {
+	defer reset()
+	appender := newTestAppender()
+	AddAppender("test", appender)
+	l := New("Test", "debug")
+	l.SetAppenders("test")
+	var code int
+	exit = func(i int) { code = i }
+
+	l.Fatalw("fatal", "k", "v")
+	if code != 1 {
+		t.Errorf("Exit code got %d, want 1", code)
+	}
+	defer func() {
+		if r := recover(); r != "panic" {
+			t.Errorf("Recovered got %v, want %v", r, "panic")
+		}
+		if got, want := len(appender.logMessages), 2; got != want {
+			t.Errorf("Message count got %d, want %d", got, want)
+		}
+		if got, want := appender.logMessages[1].properties["k"], "v"; got != want {
+			t.Errorf("Property got %v, want %v", got, want)
+		}
+	}()
+	l.Panicw("panic", "k", "v")
+}
+
+// recordingAppender uses only the exported LogMessage API, as an Appender
+// outside the package would.
+type recordingAppender struct {
+	emptyAppender
+	records []string
+}
+
+func (a *recordingAppender) Append(m *LogMessage) {
+	user, _ := m.Property("user")
+	a.records = append(a.records, fmt.Sprintf("%v|%s|%s|%d|%s|%q|%v|%v|%v|%d",
+		m.Severity(), m.LoggerName(), m.File(), m.Line(), m.Message(), m.FormatString(),
+		m.Args(), user, m.Timestamp().Year(), len(m.Properties())))
+}
+
+func TestLogMessageAccessors(t *testing.T) {
+	defer reset()
+	timenow = func() time.Time { return time.Date(2016, 7, 26, 9, 17, 57, 0, time.UTC) }
+	a := &recordingAppender{}
+	AddAppender("rec", a)
+	l := New("Test", "debug")
+	l.SetAppenders("rec")
+	SetGlobalProperty("cluster", "c1")
+
+	l.Infof("count %d", 3)
+	l.Warnw("created", "user", "bob")
+	var tests = []struct {
+		got  string
+		want string
+	}{
+		{a.records[0], `INFO|Test|log_test.go|1559|count 3|"count %d"|[3]|<nil>|2016|1`},
+		{a.records[1], `WARN|Test|log_test.go|1560|created|""|[created]|bob|2016|2`},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("Record got %q, want %q", test.got, test.want)
+		}
+	}
+}
+
+func TestSeverityString(t *testing.T) {
+	var tests = []struct {
+		s    Severity
+		want string
+	}{
+		{DebugLevel, "DEBUG"},
+		{ErrorLevel, "ERROR"},
+		{FatalLevel, "FATAL"},
+		{none, "NONE"},
+	}
+	for _, test := range tests {
+		if got := test.s.String(); got != test.want {
+			t.Errorf("String() got %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestAddFieldsNumbersValuesWithoutKeys(t *testing.T) {
+	props := make(map[string]interface{})
+	addFields(props, []interface{}{12, "order", 3, true, "x"})
+
+	want := map[string]interface{}{"!BADKEY": 12, "order": 3, "!BADKEY1": true, "!BADKEY2": "x"}
+	if !reflect.DeepEqual(props, want) {
+		t.Errorf("Properties got %v, want %v", props, want)
+	}
+}
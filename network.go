@@ -0,0 +1,57 @@
+package logo
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// defaultDialTimeout is used by the network appenders when no timeout is
+// specified.
+const defaultDialTimeout = 10 * time.Second
+
+// dial connects to address on the named network. In addition to the networks
+// supported by net.Dial, network can be "tls", which connects using TCP and
+// then TLS with tlsConfig (which may be nil).
+func dial(network, address string, tlsConfig *tls.Config, timeout time.Duration) (net.Conn, error) {
+	if timeout == 0 {
+		timeout = defaultDialTimeout
+	}
+	d := &net.Dialer{Timeout: timeout}
+	if network == "tls" {
+		return tls.DialWithDialer(d, "tcp", address, tlsConfig)
+	}
+	return d.Dial(network, address)
+}
+
+// isStream reports whether network is connection oriented, rather than
+// sending datagrams.
+func isStream(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return false
+	}
+	return true
+}
+
+// validNetwork reports whether network is supported by dial.
+func validNetwork(network string) bool {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "unix", "unixgram", "tls":
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before retry attempt n (counting from zero),
+// which starts at min and doubles with each attempt, up to max.
+func backoff(n int, min, max time.Duration) time.Duration {
+	d := min
+	for i := 0; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
@@ -0,0 +1,104 @@
+package logo
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Reload applies the configuration file most recently loaded with LoadConfig
+// again, so that changes to the file take effect. See ApplyConfig for details
+// of how the running configuration is updated.
+func Reload() error {
+	manager.mu.Lock()
+	path := manager.configPath
+	manager.mu.Unlock()
+	if path == "" {
+		return &ConfigError{Err: fmt.Errorf("no configuration file loaded")}
+	}
+	return LoadConfig(path)
+}
+
+// WatchConfig checks the named configuration file for changes every interval,
+// and loads it with LoadConfig whenever its modification time or size
+// changes. The file is not loaded when WatchConfig is called.
+// Errors are passed to the error handler (see SetErrorHandler) with an empty
+// appender name. Calling the returned function stops watching, and waits for
+// any load in progress to complete.
+func WatchConfig(path string, interval time.Duration) (stop func()) {
+	var modTime time.Time
+	var size int64
+	if fi, err := os.Stat(path); err == nil {
+		modTime, size = fi.ModTime(), fi.Size()
+	}
+
+	done, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				handleError("", &ConfigError{Err: err})
+				continue
+			}
+			if fi.ModTime().Equal(modTime) && fi.Size() == size {
+				continue
+			}
+			modTime, size = fi.ModTime(), fi.Size()
+			if err := LoadConfig(path); err != nil {
+				handleError("", err)
+			}
+		}
+	}()
+	return stopper(done, exited)
+}
+
+// ReloadOnSignal calls Reload whenever one of the specified signals is
+// received. If no signals are specified, SIGHUP is used.
+// Errors are passed to the error handler (see SetErrorHandler) with an empty
+// appender name. Calling the returned function stops handling the signals,
+// and waits for any reload in progress to complete.
+func ReloadOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+
+	done, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		defer signal.Stop(c)
+		for {
+			select {
+			case <-done:
+				return
+			case <-c:
+			}
+			if err := Reload(); err != nil {
+				handleError("", err)
+			}
+		}
+	}()
+	return stopper(done, exited)
+}
+
+// stopper returns a function which closes done, then waits for exited to be
+// closed. The function can safely be called more than once.
+func stopper(done, exited chan struct{}) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-exited
+	}
+}
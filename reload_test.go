@@ -0,0 +1,227 @@
+package logo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// registerTestAppenderType adds the appender type "test" for the duration of
+// a test, returning a pointer to the list of appenders it builds.
+func registerTestAppenderType(t *testing.T) *[]*testAppender {
+	var built []*testAppender
+	appenderTypes["test"] = func(options json.RawMessage) (Appender, error) {
+		if err := decodeOptions(options, &struct {
+			ID int `json:"id"`
+		}{}); err != nil {
+			return nil, err
+		}
+		a := newTestAppender()
+		built = append(built, a)
+		return a, nil
+	}
+	t.Cleanup(func() { delete(appenderTypes, "test") })
+	return &built
+}
+
+func applyJSON(t *testing.T, config string) {
+	t.Helper()
+	if err := Configure(strings.NewReader(config)); err != nil {
+		t.Fatalf("Configure error: %v", err)
+	}
+}
+
+func TestApplyConfigReusesUnchangedAppenders(t *testing.T) {
+	defer reset()
+	built := registerTestAppenderType(t)
+	l := New("db", "info")
+	applyJSON(t, `{
+	  "appenders": {"a": {"type": "test", "format": "%s %m", "options": {"id": 1}}},
+	  "loggers": {"db": {"appenders": ["a"]}}
+	}`)
+	applyJSON(t, `{
+	  "appenders": {"a": {"type": "test", "format": "%m", "filters": ["warn"], "options": {"id": 1}}},
+	  "loggers": {"db": {"level": "debug"}}
+	}`)
+	l.Debug("one")
+	l.Warn("two")
+
+	a := (*built)[0]
+	var tests = []struct {
+		property string
+		got      interface{}
+		want     interface{}
+	}{
+		{"appenders built", len(*built), 1},
+		{"closed", a.Closed, false},
+		{"logger level", l.effectiveLevel(), DebugLevel},
+		{"messages", strings.Join(a.Messages, "|"), "|two"}, // debug filtered
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s got %v, want %v", test.property, test.got, test.want)
+		}
+	}
+}
+
+func TestApplyConfigReplacesChangedAppenders(t *testing.T) {
+	defer reset()
+	built := registerTestAppenderType(t)
+	other := newTestAppender()
+	AddAppender("other", other)
+	l := New("db", "info")
+	applyJSON(t, `{
+	  "appenders": {"a": {"type": "test", "options": {"id": 1}}},
+	  "loggers": {"db": {"appenders": ["other", "a"]}}
+	}`)
+	clog := l.WithContextProperties(map[string]interface{}{"user": "x"})
+	applyJSON(t, `{"appenders": {"a": {"type": "test", "options": {"id": 2}}}}`)
+	clog.Info("after")
+
+	old, a := (*built)[0], (*built)[1]
+	got, _ := manager.appender("a")
+	var tests = []struct {
+		property string
+		got      interface{}
+		want     interface{}
+	}{
+		{"appenders built", len(*built), 2},
+		{"old closed", old.Closed, true},
+		{"old messages", len(old.Messages), 0},
+		{"new messages", len(a.Messages), 1},
+		{"manager appender", got, Appender(a)},
+		{"logger appenders", len(l.load().appenders), 2},
+		{"first appender", l.load().appenders[0], Appender(other)},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s got %v, want %v", test.property, test.got, test.want)
+		}
+	}
+}
+
+func TestApplyConfigRemovesUnreferencedAppenders(t *testing.T) {
+	defer reset()
+	built := registerTestAppenderType(t)
+	l := New("db", "info")
+	applyJSON(t, `{
+	  "appenders": {"a": {"type": "test"}, "b": {"type": "test"}},
+	  "loggers": {"db": {"appenders": ["a", "b"]}}
+	}`)
+	applyJSON(t, `{"appenders": {"b": {"type": "test"}}}`)
+
+	if _, ok := manager.appender("a"); ok {
+		t.Errorf("Appender a not removed")
+	}
+	if !(*built)[0].Closed {
+		t.Errorf("Appender a not closed")
+	}
+	if got, want := l.load().appenders, []Appender{(*built)[1]}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("Logger appenders got %v, want %v", got, want)
+	}
+
+	err := Configure(strings.NewReader(`{"appenders": {}, "loggers": {"db": {"appenders": ["b"]}}}`))
+	want := `logo: config: loggers.db.appenders[0]: unrecognised appender "b"`
+	if err == nil || err.Error() != want {
+		t.Errorf("Configure error got %v, want %q", err, want)
+	}
+}
+
+func TestContextLoggerFollowsParent(t *testing.T) {
+	defer reset()
+	a := newTestAppender()
+	AddAppender("test", a)
+	l := New("db", "info")
+	clog := l.WithContextProperties(map[string]interface{}{"user": "x"})
+	l.SetAppenders("test")
+	l.update(func(c *loggerConfig) {
+		c.level = DebugLevel
+	})
+	clog.Debug("message")
+
+	if got, want := len(a.Messages), 1; got != want {
+		t.Errorf("Message count got %d, want %d", got, want)
+	}
+}
+
+func TestReload(t *testing.T) {
+	defer reset()
+	if err := Reload(); err == nil {
+		t.Errorf("Reload error <nil>, want error")
+	}
+
+	path := filepath.Join(t.TempDir(), "logging.json")
+	ioutil.WriteFile(path, []byte(`{"loggers": {"db": {"level": "warn"}}}`), 0644)
+	if err := LoadConfig(path); err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+	l := LoggerByName("db")
+	ioutil.WriteFile(path, []byte(`{"loggers": {"db": {"level": "error"}}}`), 0644)
+	if err := Reload(); err != nil {
+		t.Fatalf("Reload error: %v", err)
+	}
+	if got := l.effectiveLevel(); got != ErrorLevel {
+		t.Errorf("Logger level got %v, want %v", got, ErrorLevel)
+	}
+}
+
+// waitFor polls f until it returns true or a second has elapsed.
+func waitFor(f func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if f() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestWatchConfig(t *testing.T) {
+	defer reset()
+	var r errorRecorder
+	SetErrorHandler(r.handle)
+	path := filepath.Join(t.TempDir(), "logging.json")
+	ioutil.WriteFile(path, []byte(`{"loggers": {"db": {"level": "warn"}}}`), 0644)
+	l := New("db", "info")
+
+	stop := WatchConfig(path, 10*time.Millisecond)
+	defer stop()
+	if l.effectiveLevel() != InfoLevel {
+		t.Errorf("Configuration loaded before change")
+	}
+	later := time.Now().Add(time.Second)
+	ioutil.WriteFile(path, []byte(`{"loggers": {"db": {"level": "error"}}}`), 0644)
+	os.Chtimes(path, later, later)
+
+	if !waitFor(func() bool { return l.effectiveLevel() == ErrorLevel }) {
+		t.Errorf("Logger level got %v, want %v", l.effectiveLevel(), ErrorLevel)
+	}
+	stop()
+	if len(r.errs) != 0 {
+		t.Errorf("Errors got %v, want none", r.errs)
+	}
+}
+
+func TestReloadOnSignal(t *testing.T) {
+	defer reset()
+	path := filepath.Join(t.TempDir(), "logging.json")
+	ioutil.WriteFile(path, []byte(`{"loggers": {"db": {"level": "warn"}}}`), 0644)
+	if err := LoadConfig(path); err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+	l := LoggerByName("db")
+
+	stop := ReloadOnSignal(syscall.SIGUSR1)
+	defer stop()
+	ioutil.WriteFile(path, []byte(`{"loggers": {"db": {"level": "error"}}}`), 0644)
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+
+	if !waitFor(func() bool { return l.effectiveLevel() == ErrorLevel }) {
+		t.Errorf("Logger level got %v, want %v", l.effectiveLevel(), ErrorLevel)
+	}
+}
@@ -0,0 +1,393 @@
+package logo
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Framing determines how a SocketAppender separates messages written to a
+// stream.
+type Framing int
+
+const (
+	// FramingNewline terminates each message with a newline, unless it
+	// already ends with one. This is the default.
+	FramingNewline Framing = iota
+	// FramingLengthPrefix precedes each message with its length in bytes, as
+	// a 4 byte big-endian integer.
+	FramingLengthPrefix
+)
+
+var framingNames = []string{"newline", "length-prefix"}
+
+func (f Framing) String() string {
+	if f < 0 || int(f) >= len(framingNames) {
+		return fmt.Sprintf("Framing(%d)", int(f))
+	}
+	return framingNames[f]
+}
+
+// UnmarshalText sets the framing from its name; either "newline" or
+// "length-prefix". It enables framing to be specified in configuration files.
+func (f *Framing) UnmarshalText(text []byte) error {
+	for i, n := range framingNames {
+		if strings.EqualFold(n, string(text)) {
+			*f = Framing(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unrecognised framing %q", text)
+}
+
+// SocketConfig holds the parameters for a SocketAppender.
+// Network is "tcp", "udp", "tls", "unix" or "unixgram", and Address is the
+// address to connect to, e.g. "localhost:5170" or the path of a unix socket.
+// TLSConfig is used when Network is "tls", and may be nil.
+//
+// Framing determines how messages are separated on stream connections; it is
+// ignored for datagrams, which each hold a single message.
+//
+// Messages waiting to be written, including those held while disconnected,
+// are buffered in memory, up to BufferSize bytes (the default is 1MB);
+// further messages are dropped. Reconnection is attempted after MinBackoff
+// (default 100ms), doubling after each failure up to MaxBackoff (default
+// 30s). DialTimeout limits the time taken to connect (and to write the
+// buffered messages); the default is 10 seconds.
+type SocketConfig struct {
+	Network     string
+	Address     string
+	TLSConfig   *tls.Config
+	Framing     Framing
+	BufferSize  int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	DialTimeout time.Duration
+}
+
+const (
+	defaultSocketBufferSize = 1024 * 1024
+	defaultMinBackoff       = 100 * time.Millisecond
+	defaultMaxBackoff       = 30 * time.Second
+)
+
+// SocketWriter is an appender which writes messages to a socket, reconnecting
+// when the connection fails. It is created by SocketAppender.
+type SocketWriter struct {
+	errorReporter
+	layout
+	mu           sync.Mutex
+	network      string
+	address      string
+	tls          *tls.Config
+	timeout      time.Duration
+	framing      Framing
+	stream       bool
+	conn         net.Conn
+	pending      [][]byte // messages waiting to be written
+	pendingBytes int
+	maxPending   int
+	lost         int    // messages dropped since disconnecting
+	dropped      uint64 // accessed atomically
+	frame        []byte
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	closed       bool
+	wake         chan struct{}
+	done         chan struct{}
+	wg           sync.WaitGroup
+}
+
+var errNotConnected = errors.New("socket: not connected")
+
+// SocketAppender returns an appender which writes formatted log messages to
+// a network or unix socket, as described by config. It can be used to feed
+// log collectors such as Logstash, Fluent Bit or Vector, typically with the
+// %JSON format.
+//
+// Messages are buffered by Append and written by a background goroutine, so
+// a slow or unresponsive peer never blocks the caller. If the connection
+// fails, or cannot be made when the appender is created, messages are
+// buffered while the appender reconnects in the background, and are written
+// once the connection is restored. SocketAppender only returns an error if
+// config is invalid.
+//
+// Close writes any buffered messages, if connected, and closes the
+// connection; messages which cannot be written are discarded.
+//
+// SocketAppender uses the default format.
+func SocketAppender(config SocketConfig) (*SocketWriter, error) {
+	if !validNetwork(config.Network) {
+		return nil, fmt.Errorf("socket: unknown network %q", config.Network)
+	}
+	if config.Address == "" {
+		return nil, errors.New("socket: address required")
+	}
+	if config.Framing < FramingNewline || config.Framing > FramingLengthPrefix {
+		return nil, fmt.Errorf("socket: unknown framing %v", config.Framing)
+	}
+
+	a := &SocketWriter{
+		network:    config.Network,
+		address:    config.Address,
+		tls:        config.TLSConfig,
+		timeout:    config.DialTimeout,
+		framing:    config.Framing,
+		stream:     isStream(config.Network),
+		maxPending: config.BufferSize,
+		minBackoff: config.MinBackoff,
+		maxBackoff: config.MaxBackoff,
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	if a.timeout <= 0 {
+		a.timeout = defaultDialTimeout
+	}
+	if a.maxPending <= 0 {
+		a.maxPending = defaultSocketBufferSize
+	}
+	if a.minBackoff <= 0 {
+		a.minBackoff = defaultMinBackoff
+	}
+	if a.maxBackoff <= 0 {
+		a.maxBackoff = defaultMaxBackoff
+	}
+	if a.maxBackoff < a.minBackoff {
+		a.maxBackoff = a.minBackoff
+	}
+
+	a.SetFormat(defaultFormat)
+	a.SetFilters(severityName...)
+
+	if c, err := dial(a.network, a.address, a.tls, a.timeout); err == nil {
+		a.conn = c
+	} else {
+		a.signal()
+	}
+	a.wg.Add(1)
+	go a.run()
+	return a, nil
+}
+
+// Append buffers the formatted message to be written by the background
+// goroutine.
+func (a *SocketWriter) Append(m *LogMessage) {
+	ok, err := a.format(m)
+	if err != nil {
+		a.reportError(err)
+	}
+	if !ok {
+		return
+	}
+
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		atomic.AddUint64(&a.dropped, 1)
+		return
+	}
+	a.frame = a.appendFrame(a.frame[:0], m.Bytes())
+	a.enqueue(a.frame)
+	a.mu.Unlock()
+	a.signal()
+}
+
+// appendFrame appends the message p, framed for the connection, to b.
+func (a *SocketWriter) appendFrame(b, p []byte) []byte {
+	if !a.stream {
+		return append(b, p...)
+	}
+	switch a.framing {
+	case FramingLengthPrefix:
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(p)))
+		b = append(b, n[:]...)
+		b = append(b, p...)
+	default:
+		b = append(b, p...)
+		if len(p) == 0 || p[len(p)-1] != '\n' {
+			b = append(b, '\n')
+		}
+	}
+	return b
+}
+
+// enqueue buffers a copy of the frame until it can be written, or drops it
+// if the buffer is full. It must be called with a.mu held.
+func (a *SocketWriter) enqueue(frame []byte) {
+	if a.pendingBytes+len(frame) > a.maxPending {
+		if a.conn == nil {
+			a.lost++
+		}
+		atomic.AddUint64(&a.dropped, 1)
+		return
+	}
+	a.pending = append(a.pending, append([]byte(nil), frame...))
+	a.pendingBytes += len(frame)
+}
+
+// signal wakes the background goroutine, if it is not already due to run.
+func (a *SocketWriter) signal() {
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run writes buffered messages whenever it is signalled, reconnecting as
+// required, until the appender is closed.
+func (a *SocketWriter) run() {
+	defer a.wg.Done()
+	for {
+		select {
+		case <-a.done:
+			if err := a.flush(); err != nil && err != errNotConnected {
+				a.reportError(fmt.Errorf("socket: %v", err))
+			}
+			return
+		case <-a.wake:
+		}
+
+		for {
+			err := a.flush()
+			if err == nil {
+				break
+			}
+			if err != errNotConnected {
+				a.reportError(fmt.Errorf("socket: %v", err))
+			}
+			if !a.reconnect() {
+				return
+			}
+		}
+	}
+}
+
+// flush writes the buffered messages, returning errNotConnected if there is
+// no connection. a.mu is not held while writing, so that Append never waits
+// for the network; pendingBytes still counts the messages being written.
+// If a write fails the connection is closed and the unwritten messages are
+// returned to the buffer.
+func (a *SocketWriter) flush() error {
+	for {
+		a.mu.Lock()
+		conn, frames := a.conn, a.pending
+		if conn == nil || len(frames) == 0 {
+			a.mu.Unlock()
+			if conn == nil {
+				return errNotConnected
+			}
+			return nil
+		}
+		a.pending = nil
+		a.mu.Unlock()
+
+		conn.SetWriteDeadline(time.Now().Add(a.timeout))
+		var err error
+		n, written := 0, 0
+		for ; n < len(frames); n++ {
+			if _, err = conn.Write(frames[n]); err != nil {
+				break
+			}
+			written += len(frames[n])
+		}
+
+		a.mu.Lock()
+		a.pendingBytes -= written
+		if err != nil {
+			a.pending = append(frames[n:], a.pending...)
+			a.conn = nil
+		}
+		a.mu.Unlock()
+
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+}
+
+// reconnect tries to connect, with exponential backoff, until it succeeds or
+// the appender is closed, in which case it returns false.
+func (a *SocketWriter) reconnect() bool {
+	for attempt := 0; ; attempt++ {
+		t := time.NewTimer(backoff(attempt, a.minBackoff, a.maxBackoff))
+		select {
+		case <-a.done:
+			t.Stop()
+			return false
+		case <-t.C:
+		}
+
+		c, err := dial(a.network, a.address, a.tls, a.timeout)
+		if err != nil {
+			if attempt == 0 {
+				a.reportError(fmt.Errorf("socket: reconnect failed: %v", err))
+			}
+			continue
+		}
+
+		a.mu.Lock()
+		if a.closed {
+			a.mu.Unlock()
+			c.Close()
+			return false
+		}
+		a.conn = c
+		lost := a.lost
+		a.lost = 0
+		a.mu.Unlock()
+
+		if lost > 0 {
+			a.reportError(fmt.Errorf("socket: %d messages dropped while disconnected", lost))
+		}
+		return true
+	}
+}
+
+// Dropped returns the number of messages discarded because the buffer was
+// full or the appender was closed.
+func (a *SocketWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Connected reports whether the appender is currently connected.
+func (a *SocketWriter) Connected() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.conn != nil
+}
+
+// Close writes any buffered messages, if connected, and closes the
+// connection.
+func (a *SocketWriter) Close() {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return
+	}
+	a.closed = true
+	close(a.done)
+	a.mu.Unlock()
+	a.wg.Wait()
+
+	a.mu.Lock()
+	conn := a.conn
+	a.conn = nil
+	if n := len(a.pending); n > 0 {
+		atomic.AddUint64(&a.dropped, uint64(n))
+		a.pending, a.pendingBytes = nil, 0
+	}
+	a.mu.Unlock()
+	if conn != nil {
+		if err := conn.Close(); err != nil {
+			a.reportError(fmt.Errorf("close failed: %v", err))
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package logo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// acceptLines accepts connections on l, sending each newline terminated
+// line received to the returned channel.
+func acceptLines(l net.Listener) <-chan string {
+	lines := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					s, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					lines <- s
+				}
+			}()
+		}
+	}()
+	return lines
+}
+
+func receive(t *testing.T, c <-chan string) string {
+	t.Helper()
+	select {
+	case s := <-c:
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("Message not received")
+	}
+	return ""
+}
+
+func TestSocketAppenderNewlineFraming(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	lines := acceptLines(l)
+
+	a, err := SocketAppender(SocketConfig{Network: "tcp", Address: l.Addr().String()})
+	if err != nil {
+		t.Fatalf("SocketAppender error: %v", err)
+	}
+	defer a.Close()
+
+	var tests = []struct {
+		format string
+		want   string
+	}{
+		{"%s %m", "INFO Test 34 (56)\n"},
+		{"%s %m%n", "INFO Test 34 (56)\n"},
+		{"%JSON{timestamp=-,file=-,line=-,properties=-}", `{"level":"INFO","logger":{"name":"Logger"},"message":"Test 34 (56)"}` + "\n"},
+	}
+	for _, test := range tests {
+		a.SetFormat(test.format)
+		a.Append(testMessage())
+		if got := receive(t, lines); got != test.want {
+			t.Errorf("%s got %q, want %q", test.format, got, test.want)
+		}
+	}
+}
+
+func TestSocketAppenderLengthPrefixFraming(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "log.sock")
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Skipf("unix sockets not supported: %v", err)
+	}
+	defer l.Close()
+
+	a, err := SocketAppender(SocketConfig{Network: "unix", Address: addr, Framing: FramingLengthPrefix})
+	if err != nil {
+		t.Fatalf("SocketAppender error: %v", err)
+	}
+	defer a.Close()
+	a.SetFormat("%s %m")
+	a.Append(testMessage())
+	a.Append(testMessage())
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 2; i++ {
+		var n uint32
+		if err := binary.Read(conn, binary.BigEndian, &n); err != nil {
+			t.Fatalf("Read length error: %v", err)
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			t.Fatalf("Read message error: %v", err)
+		}
+		if got, want := string(b), "INFO Test 34 (56)"; got != want {
+			t.Errorf("Message %d got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestSocketAppenderBuffersWhileDisconnected(t *testing.T) {
+	defer reset()
+	var r errorRecorder
+	SetErrorHandler(r.handle)
+
+	// reserve an address which is not yet listening
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	a, err := SocketAppender(SocketConfig{
+		Network:    "tcp",
+		Address:    addr,
+		BufferSize: 40,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("SocketAppender error: %v", err)
+	}
+	AddAppender("socket", a)
+	a.SetFormat("%m")
+
+	m := testMessage()
+	m.args = nil
+	for _, s := range []string{"one", "two", "three", "a message which does not fit"} {
+		m.format = s
+		a.Append(m)
+	}
+	if got, want := a.Dropped(), uint64(1); got != want {
+		t.Errorf("Dropped got %d, want %d", got, want)
+	}
+
+	l, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("address reused: %v", err)
+	}
+	defer l.Close()
+	lines := acceptLines(l)
+	for _, want := range []string{"one\n", "two\n", "three\n"} {
+		if got := receive(t, lines); got != want {
+			t.Errorf("Message got %q, want %q", got, want)
+		}
+	}
+	if !waitFor(a.Connected) {
+		t.Errorf("Connected got false, want true")
+	}
+	a.Close()
+
+	found := false
+	for _, e := range r.errs {
+		found = found || e == "socket: 1 messages dropped while disconnected"
+	}
+	if !found {
+		t.Errorf("Errors got %q, want dropped message report", r.errs)
+	}
+	m.format = "closed"
+	a.Append(m)
+	if got, want := a.Dropped(), uint64(2); got != want {
+		t.Errorf("Dropped after close got %d, want %d", got, want)
+	}
+}
+
+func TestSocketAppenderDoesNotBlockWhenPeerStopsReading(t *testing.T) {
+	defer reset()
+	var r errorRecorder
+	SetErrorHandler(r.handle)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	conns := make(chan net.Conn, 1)
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			conns <- c
+		}
+	}()
+
+	a, err := SocketAppender(SocketConfig{Network: "tcp", Address: l.Addr().String(), BufferSize: 64 * 1024})
+	if err != nil {
+		t.Fatalf("SocketAppender error: %v", err)
+	}
+	a.SetFormat("%m")
+
+	// the peer never reads, so the socket buffers fill long before the
+	// messages have all been appended
+	m := testMessage()
+	m.args = nil
+	m.format = strings.Repeat("x", 1024)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 20000; i++ {
+			a.Append(m)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Append blocked while the peer was not reading")
+	}
+	if a.Dropped() == 0 {
+		t.Errorf("Dropped got 0, want > 0")
+	}
+
+	select {
+	case c := <-conns:
+		c.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Connection not accepted")
+	}
+	a.Close()
+}
+
+func TestSocketAppenderReturnsErrorWhenInvalidConfig(t *testing.T) {
+	var tests = []struct {
+		config SocketConfig
+		want   string
+	}{
+		{SocketConfig{Network: "sctp", Address: "localhost:5170"}, `socket: unknown network "sctp"`},
+		{SocketConfig{Network: "tcp"}, "socket: address required"},
+		{SocketConfig{Network: "tcp", Address: "localhost:5170", Framing: Framing(7)}, "socket: unknown framing Framing(7)"},
+	}
+	for _, test := range tests {
+		_, err := SocketAppender(test.config)
+		if err == nil {
+			t.Errorf("%+v got <nil>, want %q", test.config, test.want)
+			continue
+		}
+		if got := err.Error(); got != test.want {
+			t.Errorf("%+v got %q, want %q", test.config, got, test.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	var tests = []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{5, time.Second},
+		{100, time.Second},
+	}
+	for _, test := range tests {
+		if got := backoff(test.attempt, 100*time.Millisecond, time.Second); got != test.want {
+			t.Errorf("Attempt %d got %v, want %v", test.attempt, got, test.want)
+		}
+	}
+}
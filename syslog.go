@@ -0,0 +1,395 @@
+package logo
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyslogConfig holds the parameters for a SyslogAppender.
+// Network is "udp", "tcp", "tls", "unix" or "unixgram", and Address is the
+// address of the syslog server, e.g. "logs.example.com:514" or the path of a
+// unix socket. If Network and Address are both empty, the appender connects
+// to the local syslog daemon (e.g. /dev/log). TLSConfig is used when Network
+// is "tls", and may be nil.
+//
+// Messages are sent in the RFC 5424 format, unless RFC3164 is set, in which
+// case the older BSD format is used (which is often required by local syslog
+// daemons). Facility is the syslog facility name, e.g. "local0"; the default
+// is "user". AppName and Hostname identify the source of each message, and
+// default to the program name and the host name.
+//
+// In the RFC 5424 format, the logger name is sent as the MSGID, and global
+// properties (see SetGlobalProperty) are sent as structured data with the
+// SD-ID StructuredDataID, which defaults to "logo@32473". Applications should
+// normally specify their own SD-ID, using their private enterprise number.
+//
+// DialTimeout limits the time taken to connect (and write each message);
+// the default is 10 seconds.
+type SyslogConfig struct {
+	Network          string
+	Address          string
+	TLSConfig        *tls.Config
+	RFC3164          bool
+	Facility         string
+	AppName          string
+	Hostname         string
+	StructuredDataID string
+	DialTimeout      time.Duration
+}
+
+// syslogFacilities maps facility names to their codes.
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// syslogSeverity maps logo severities to syslog severities.
+var syslogSeverity = []int{
+	7, // DEBUG: debug
+	6, // INFO: informational
+	4, // WARN: warning
+	3, // ERROR: error
+	2, // PANIC: critical
+	1, // FATAL: alert
+}
+
+// syslogLevel returns the syslog severity for s. Messages without a logo
+// severity, such as those captured from the standard logger, are sent as
+// notice.
+func syslogLevel(s Severity) int {
+	if s < 0 || int(s) >= len(syslogSeverity) {
+		return 5
+	}
+	return syslogSeverity[s]
+}
+
+// localSyslogAddresses are the usual locations of the local syslog socket.
+var localSyslogAddresses = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+type syslogAppender struct {
+	errorReporter
+	layout
+	mu       sync.Mutex
+	network  string
+	address  string
+	tls      *tls.Config
+	timeout  time.Duration
+	conn     net.Conn
+	rfc3164  bool
+	facility int
+	appName  string
+	hostname string
+	sdID     string
+	buf      []byte
+	scratch  []byte
+	closed   bool
+}
+
+// SyslogAppender returns an appender which sends log messages to a syslog
+// server, as described by config. Logo severities are mapped to the syslog
+// severities debug, informational, warning, error, critical (PANIC) and
+// alert (FATAL); messages captured from the standard logger are sent as
+// notice.
+//
+// SyslogAppender connects when it is created, and returns an error if the
+// connection fails. If a message cannot be sent later, the appender
+// reconnects and sends it again; if that fails, the message is dropped and
+// the error is reported, and the appender reconnects when the next message
+// is logged. Messages sent over TCP or TLS are framed using octet counting
+// (RFC 6587). Sending blocks the logger, so an AsyncAppender should be used
+// for remote servers.
+//
+// SyslogAppender uses the format "%message", as the syslog header includes
+// the timestamp and severity.
+func SyslogAppender(config SyslogConfig) (Appender, error) {
+	a := &syslogAppender{
+		network:  config.Network,
+		address:  config.Address,
+		tls:      config.TLSConfig,
+		timeout:  config.DialTimeout,
+		rfc3164:  config.RFC3164,
+		appName:  config.AppName,
+		hostname: config.Hostname,
+		sdID:     config.StructuredDataID,
+	}
+	if a.timeout == 0 {
+		a.timeout = defaultDialTimeout
+	}
+
+	if config.Network == "" {
+		if config.Address != "" {
+			return nil, errors.New("syslog: network required")
+		}
+	} else if !validNetwork(config.Network) {
+		return nil, fmt.Errorf("syslog: unknown network %q", config.Network)
+	} else if config.Address == "" {
+		return nil, errors.New("syslog: address required")
+	}
+
+	facility := config.Facility
+	if facility == "" {
+		facility = "user"
+	}
+	f, ok := syslogFacilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, fmt.Errorf("syslog: unknown facility %q", facility)
+	}
+	a.facility = f
+
+	if a.appName == "" {
+		a.appName = filepath.Base(os.Args[0])
+	}
+	if a.hostname == "" {
+		a.hostname, _ = os.Hostname()
+	}
+	if a.sdID == "" {
+		a.sdID = "logo@32473"
+	}
+
+	a.SetFormat("%message")
+	a.SetFilters(severityName...)
+	if err := a.connect(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// connect opens a connection to the syslog server. It must be called with
+// a.mu held, or before the appender is used.
+func (a *syslogAppender) connect() error {
+	if a.network != "" {
+		c, err := dial(a.network, a.address, a.tls, a.timeout)
+		if err != nil {
+			return fmt.Errorf("syslog: %v", err)
+		}
+		a.conn = c
+		return nil
+	}
+
+	for _, addr := range localSyslogAddresses {
+		for _, network := range []string{"unixgram", "unix"} {
+			if c, err := dial(network, addr, nil, a.timeout); err == nil {
+				a.conn = c
+				a.network, a.address = network, addr
+				return nil
+			}
+		}
+	}
+	return errors.New("syslog: local syslog daemon unavailable")
+}
+
+func (a *syslogAppender) Append(m *LogMessage) {
+	ok, err := a.format(m)
+	if err != nil {
+		a.reportError(err)
+	}
+	if !ok {
+		return
+	}
+
+	// errors are reported once a.mu is released, so that an error handler
+	// can log to this appender
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return
+	}
+	a.buf = a.message(a.buf[:0], m)
+	err = a.send(a.buf)
+	a.mu.Unlock()
+	if err != nil {
+		a.reportError(err)
+	}
+}
+
+// message appends the syslog message for m, including any framing, to b.
+func (a *syslogAppender) message(b []byte, m *LogMessage) []byte {
+	msg := bytes.TrimRight(m.Bytes(), "\r\n")
+	a.scratch = a.appendMessage(a.scratch[:0], m, msg)
+	switch {
+	case a.network == "tcp" || a.network == "tcp4" || a.network == "tcp6" || a.network == "tls":
+		// octet counting
+		b = strconv.AppendInt(b, int64(len(a.scratch)), 10)
+		b = append(b, ' ')
+		b = append(b, a.scratch...)
+	case isStream(a.network):
+		b = append(b, a.scratch...)
+		b = append(b, '\n')
+	default:
+		b = append(b, a.scratch...)
+	}
+	return b
+}
+
+// appendMessage appends the syslog header for m, followed by msg, to b.
+func (a *syslogAppender) appendMessage(b []byte, m *LogMessage, msg []byte) []byte {
+	b = append(b, '<')
+	b = strconv.AppendInt(b, int64(a.facility*8+syslogLevel(m.severity)), 10)
+	b = append(b, '>')
+
+	if a.rfc3164 {
+		b = m.timestamp.AppendFormat(b, time.Stamp)
+		b = append(b, ' ')
+		b = appendSyslogField(b, a.hostname, 255)
+		b = append(b, ' ')
+		b = appendSyslogField(b, a.appName, 48)
+		b = append(b, '[')
+		b = strconv.AppendInt(b, int64(pid), 10)
+		b = append(b, "]: "...)
+		return append(b, msg...)
+	}
+
+	b = append(b, "1 "...)
+	b = m.timestamp.AppendFormat(b, "2006-01-02T15:04:05.000000Z07:00")
+	b = append(b, ' ')
+	b = appendSyslogField(b, a.hostname, 255)
+	b = append(b, ' ')
+	b = appendSyslogField(b, a.appName, 48)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(pid), 10)
+	b = append(b, ' ')
+	b = appendSyslogField(b, m.name, 32)
+	b = append(b, ' ')
+	b = a.appendStructuredData(b)
+	if len(msg) > 0 {
+		b = append(b, ' ')
+		b = append(b, msg...)
+	}
+	return b
+}
+
+// appendStructuredData appends the global properties as an SD-ELEMENT, or
+// the nil value "-" if there are none.
+func (a *syslogAppender) appendStructuredData(b []byte) []byte {
+	props := manager.getProperties()
+	if len(props) == 0 {
+		return append(b, '-')
+	}
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b = append(b, '[')
+	b = appendSDName(b, a.sdID, 32)
+	for _, k := range keys {
+		b = append(b, ' ')
+		b = appendSDName(b, k, 32)
+		b = append(b, `="`...)
+		for _, r := range fmt.Sprint(props[k]) {
+			if r == '"' || r == '\\' || r == ']' {
+				b = append(b, '\\')
+			}
+			b = append(b, string(r)...)
+		}
+		b = append(b, '"')
+	}
+	return append(b, ']')
+}
+
+// appendSyslogField appends s as a header field, which must be printable
+// ASCII without spaces, and at most max characters. Invalid characters are
+// replaced by '_', and an empty field is written as "-".
+func appendSyslogField(b []byte, s string, max int) []byte {
+	if s == "" {
+		return append(b, '-')
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c > '~' {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// appendSDName appends s as an SD-ID or PARAM-NAME, which additionally must
+// not contain '=', ']' or '"'.
+func appendSDName(b []byte, s string, max int) []byte {
+	start := len(b)
+	b = appendSyslogField(b, s, max)
+	for i := start; i < len(b); i++ {
+		if c := b[i]; c == '=' || c == ']' || c == '"' {
+			b[i] = '_'
+		}
+	}
+	return b
+}
+
+// send writes p to the server, reconnecting and trying again if the write
+// fails. It must be called with a.mu held.
+func (a *syslogAppender) send(p []byte) error {
+	if a.conn == nil {
+		if err := a.connect(); err != nil {
+			return err
+		}
+	}
+	if err := a.write(p); err == nil {
+		return nil
+	}
+	// the connection may have been closed by the server
+	a.conn.Close()
+	a.conn = nil
+	if err := a.connect(); err != nil {
+		return err
+	}
+	if err := a.write(p); err != nil {
+		a.conn.Close()
+		a.conn = nil
+		return fmt.Errorf("syslog: %v", err)
+	}
+	return nil
+}
+
+func (a *syslogAppender) write(p []byte) error {
+	a.conn.SetWriteDeadline(time.Now().Add(a.timeout))
+	_, err := a.conn.Write(p)
+	return err
+}
+
+func (a *syslogAppender) Close() {
+	a.mu.Lock()
+	a.closed = true
+	var err error
+	if a.conn != nil {
+		err = a.conn.Close()
+		a.conn = nil
+	}
+	a.mu.Unlock()
+	if err != nil {
+		a.reportError(fmt.Errorf("close failed: %v", err))
+	}
+}
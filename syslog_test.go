@@ -0,0 +1,201 @@
+package logo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readDatagram(t *testing.T, c net.PacketConn) string {
+	t.Helper()
+	b := make([]byte, 4096)
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := c.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("ReadFrom error: %v", err)
+	}
+	return string(b[:n])
+}
+
+func TestSyslogAppenderRFC5424(t *testing.T) {
+	defer reset()
+	c, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	a, err := SyslogAppender(SyslogConfig{
+		Network:  "udp",
+		Address:  c.LocalAddr().String(),
+		Facility: "local0",
+		AppName:  "shop",
+		Hostname: "web1",
+	})
+	if err != nil {
+		t.Fatalf("SyslogAppender error: %v", err)
+	}
+	defer a.Close()
+
+	var tests = []struct {
+		severity Severity
+		name     string
+		props    map[string]interface{}
+		want     string
+	}{
+		{DebugLevel, "Orders", nil, "<135>1 2016-04-09T18:03:28.342017Z web1 shop %d Orders - Test 34 (56)"},
+		{InfoLevel, "", nil, "<134>1 2016-04-09T18:03:28.342017Z web1 shop %d - - Test 34 (56)"},
+		{WarnLevel, "db pool", map[string]interface{}{"region": "eu", "build": 7}, `<132>1 2016-04-09T18:03:28.342017Z web1 shop %d db_pool [logo@32473 build="7" region="eu"] Test 34 (56)`},
+		{ErrorLevel, "db", map[string]interface{}{"a=b": `x"]\`}, `<131>1 2016-04-09T18:03:28.342017Z web1 shop %d db [logo@32473 a_b="x\"\]\\"] Test 34 (56)`},
+		{PanicLevel, "db", nil, "<130>1 2016-04-09T18:03:28.342017Z web1 shop %d db - Test 34 (56)"},
+		{FatalLevel, "db", nil, "<129>1 2016-04-09T18:03:28.342017Z web1 shop %d db - Test 34 (56)"},
+		{none, "", nil, "<133>1 2016-04-09T18:03:28.342017Z web1 shop %d - - Test 34 (56)"},
+	}
+	for _, test := range tests {
+		manager.properties.Store(map[string]interface{}{})
+		for k, v := range test.props {
+			SetGlobalProperty(k, v)
+		}
+		m := testMessage()
+		m.severity = test.severity
+		m.name = test.name
+		a.Append(m)
+		want := fmt.Sprintf(test.want, pid)
+		if got := readDatagram(t, c); got != want {
+			t.Errorf("%v got %q, want %q", test.severity, got, want)
+		}
+	}
+}
+
+func TestSyslogAppenderRFC3164OverUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "log.sock")
+	c, err := net.ListenPacket("unixgram", addr)
+	if err != nil {
+		t.Skipf("unixgram not supported: %v", err)
+	}
+	defer c.Close()
+
+	a, err := SyslogAppender(SyslogConfig{
+		Network:  "unixgram",
+		Address:  addr,
+		RFC3164:  true,
+		Facility: "daemon",
+		AppName:  "shop",
+		Hostname: "web1",
+	})
+	if err != nil {
+		t.Fatalf("SyslogAppender error: %v", err)
+	}
+	defer a.Close()
+	a.SetFormat("%logger: %message%newline")
+
+	a.Append(testMessage())
+	want := fmt.Sprintf("<30>Apr  9 18:03:28 web1 shop[%d]: Logger: Test 34 (56)", pid)
+	if got := readDatagram(t, c); got != want {
+		t.Errorf("Message got %q, want %q", got, want)
+	}
+}
+
+func TestSyslogAppenderReconnectsOverTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	messages := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					var n int
+					if _, err := fmt.Fscanf(r, "%d ", &n); err != nil {
+						return
+					}
+					b := make([]byte, n)
+					if _, err := io.ReadFull(r, b); err != nil {
+						return
+					}
+					messages <- string(b)
+					if strings.HasSuffix(string(b), "disconnect") {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	a, err := SyslogAppender(SyslogConfig{Network: "tcp", Address: l.Addr().String(), Hostname: "web1", AppName: "shop"})
+	if err != nil {
+		t.Fatalf("SyslogAppender error: %v", err)
+	}
+	defer a.Close()
+	a.SetFormat("%message")
+
+	m := testMessage()
+	m.format, m.args = "disconnect", nil
+	a.Append(m)
+	want := fmt.Sprintf("<14>1 2016-04-09T18:03:28.342017Z web1 shop %d Logger - disconnect", pid)
+	select {
+	case got := <-messages:
+		if got != want {
+			t.Errorf("Message got %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Message not received")
+	}
+
+	// the server has closed the connection, so the first writes may be lost
+	m.format = "reconnected"
+	received := waitFor(func() bool {
+		a.Append(m)
+		select {
+		case got := <-messages:
+			return strings.HasSuffix(got, "reconnected")
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	})
+	if !received {
+		t.Errorf("Message not received after reconnecting")
+	}
+}
+
+func TestSyslogAppenderReturnsErrorWhenInvalidConfig(t *testing.T) {
+	var tests = []struct {
+		config SyslogConfig
+		want   string
+	}{
+		{SyslogConfig{Address: "localhost:514"}, "syslog: network required"},
+		{SyslogConfig{Network: "sctp", Address: "localhost:514"}, `syslog: unknown network "sctp"`},
+		{SyslogConfig{Network: "udp"}, "syslog: address required"},
+		{SyslogConfig{Network: "udp", Address: "localhost:514", Facility: "local9"}, `syslog: unknown facility "local9"`},
+	}
+	for _, test := range tests {
+		_, err := SyslogAppender(test.config)
+		if err == nil {
+			t.Errorf("%+v got <nil>, want %q", test.config, test.want)
+			continue
+		}
+		if got := err.Error(); got != test.want {
+			t.Errorf("%+v got %q, want %q", test.config, got, test.want)
+		}
+	}
+}